@@ -0,0 +1,71 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+// Artifact is a built bundle. Artifacts are immutable once created so they
+// can be served while the bundle is being rebuilt
+type Artifact struct {
+	Data     []byte    `json:"-"`
+	Etag     string    `json:"etag"`
+	Revision string    `json:"revision"`
+	BuiltAt  time.Time `json:"built_at"`
+}
+
+// NewArtifact creates a new artifact from bundle data
+func NewArtifact(data []byte, revision string) *Artifact {
+	return &Artifact{
+		Data:     data,
+		Etag:     fmt.Sprintf("%x", md5.Sum(data)),
+		Revision: revision,
+		BuiltAt:  time.Now().UTC(),
+	}
+}
+
+// manifestRevision reads the revision from the manifest of the bundle
+// archive. An empty revision is returned if there is no manifest
+func manifestRevision(data []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+
+		if path.Clean("/"+header.Name) != "/"+bundle.ManifestExt {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return "", err
+		}
+
+		manifest := bundle.Manifest{}
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return "", err
+		}
+
+		return manifest.Revision, nil
+	}
+}
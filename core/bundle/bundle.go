@@ -2,10 +2,13 @@ package bundle
 
 import (
 	"context"
-	"crypto/md5"
 	"fmt"
 	"math/rand"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bhoriuchi/opa-bundle-server/core/config"
@@ -25,36 +28,80 @@ const (
 )
 
 type Bundle struct {
-	mx          sync.Mutex
-	dq          *lane.Deque
-	Name        string
-	Logger      logger.Logger
-	Store       store.Store
-	Webhooks    []string
-	Subscribers []string
-	Publishers  []publisher.Publisher
-	Deployers   []deployer.Deployer
-	Config      *config.Bundle
-	data        []byte
-	etag        string
-	activated   bool
-	pollCancel  context.CancelFunc
+	mx            sync.Mutex
+	sx            sync.Mutex
+	qx            sync.Once
+	dq            *lane.Deque
+	Name          string
+	Logger        logger.Logger
+	Store         store.Store
+	Webhooks      []string
+	Subscribers   []string
+	Publishers    []publisher.Publisher
+	Deployers     map[string]deployer.Deployer
+	Config        *config.Bundle
+	Leader        func() bool
+	CacheDir      string
+	artifact      atomic.Value
+	attempted     time.Time
+	failure       *Failure
+	deployFailure *Failure
+	initial       string
+	deployed      string
+	polled        string
+	activated     bool
+	pollCancel    context.CancelFunc
+}
+
+// Artifact returns the last successfully built artifact or nil if the
+// bundle has not been built. Reading the artifact never waits on a build
+func (b *Bundle) Artifact() *Artifact {
+	a, _ := b.artifact.Load().(*Artifact)
+	return a
 }
 
 // Data returns the bundle data
 func (b *Bundle) Data() []byte {
-	b.mx.Lock()
-	defer b.mx.Unlock()
-
-	return b.data
+	if a := b.Artifact(); a != nil {
+		return a.Data
+	}
+	return nil
 }
 
 // Etag returns the bundle's etag which is the md5 sum of its contents
 func (b *Bundle) Etag() string {
+	if a := b.Artifact(); a != nil {
+		return a.Etag
+	}
+	return ""
+}
+
+// Inherit copies the built bundle from a previous instance of the bundle
+// so that it can be served until this bundle is rebuilt. The deployment
+// state is only kept if the deployers are the same
+func (b *Bundle) Inherit(prev *Bundle) {
+	prev.mx.Lock()
+	defer prev.mx.Unlock()
+
 	b.mx.Lock()
 	defer b.mx.Unlock()
 
-	return b.etag
+	if a := prev.Artifact(); a != nil {
+		b.artifact.Store(a)
+	}
+	b.initial = prev.initial
+
+	if len(b.Deployers) != len(prev.Deployers) {
+		return
+	}
+
+	for name, dep := range prev.Deployers {
+		if b.Deployers[name] != dep {
+			return
+		}
+	}
+
+	b.deployed = prev.deployed
 }
 
 // Rebuild rebuilds the bundle. Becuase requests to this function are made asynchronously
@@ -62,39 +109,167 @@ func (b *Bundle) Etag() string {
 // to rebuild during a rebuild operation will still be processed but will be combined into
 // a single queued up rebuild instead of n-rebuilds
 func (b *Bundle) Rebuild(ctx context.Context) error {
-	return utils.Enqueue(b.dq, "", func(id interface{}, args ...interface{}) error {
+	return b.rebuild(ctx, "")
+}
+
+// rebuild rebuilds the bundle and records the store revision polled before
+// the build once it is released so that polling can skip unchanged revisions
+func (b *Bundle) rebuild(ctx context.Context, polled string) error {
+	return utils.Enqueue(b.queue(), "", func(id interface{}, args ...interface{}) error {
 		b.mx.Lock()
 		defer b.mx.Unlock()
 
-		var err error
 		b.Logger.Debug("request %s rebuilding bundle %s", id, b.Name)
 
-		// create the bundle
-		if b.data, err = b.Store.Bundle(ctx); err != nil {
+		// create the bundle. a failed build leaves the
+		// current artifact in place
+		data, err := b.build(ctx)
+		b.recordBuild(err)
+		if err != nil {
+			b.Logger.Error("failed to build bundle %s: %s", b.Name, err)
 			return err
 		}
 
-		// calculate the etag and determine if it changed
-		lastEtag := b.etag
-		b.etag = fmt.Sprintf("%x", md5.Sum(b.data))
+		revision, err := manifestRevision(data)
+		if err != nil {
+			b.Logger.Warn("failed to read the revision of bundle %s: %s", b.Name, err)
+		}
 
-		// if etag has changed, the bundle was updated
-		// if the last etag is empty, this is the first update
-		// so ignore publishing updates
-		if lastEtag != b.etag && lastEtag != "" {
-			// TODO: perform deployments
+		// swap in the new artifact
+		a := NewArtifact(data, revision)
+		prev := b.Artifact()
+		b.artifact.Store(a)
+		if b.initial == "" {
+			b.initial = a.Etag
+		}
 
-			// publish events on successful deployments
-			payload := []byte(fmt.Sprintf(`{"etag":%q}`, b.etag))
-			for _, pub := range b.Publishers {
-				go pub.Publish(ctx, payload)
+		// persist changed artifacts so they can be served on restart
+		if b.CacheDir != "" && (prev == nil || prev.Etag != a.Etag) {
+			if err := b.writeCache(a); err != nil {
+				b.Logger.Error("failed to write bundle %s to cache directory %s: %s", b.Name, b.CacheDir, err)
 			}
 		}
 
+		// the revision is only recorded once the bundle is released so
+		// that failed deployments are retried on the next poll
+		if err := b.release(ctx); err != nil {
+			return err
+		}
+
+		b.polled = polled
 		return nil
 	})
 }
 
+// queue returns the rebuild queue. It is created on first use so that a
+// bundle can be rebuilt by a callback as soon as it is registered, even
+// before it is activated
+func (b *Bundle) queue() *lane.Deque {
+	b.qx.Do(func() {
+		b.dq = lane.NewCappedDeque(1)
+	})
+	return b.dq
+}
+
+// build builds the bundle from its store
+func (b *Bundle) build(ctx context.Context) ([]byte, error) {
+	opts, err := b.buildOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Store.Bundle(ctx, opts)
+}
+
+// Deploy performs a catch-up deployment of the current bundle regardless
+// of what was previously deployed by this node. It is used when this node
+// becomes the leader
+func (b *Bundle) Deploy(ctx context.Context) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.deployed = ""
+	return b.release(ctx)
+}
+
+// isLeader returns true if this node is allowed to deploy and publish
+func (b *Bundle) isLeader() bool {
+	return b.Leader == nil || b.Leader()
+}
+
+// release deploys and publishes the current bundle if it has changed since
+// the last successful deployment. Only the leader releases bundles and
+// deployments are retried on the next rebuild until they succeed. The
+// result of each deployment is recorded in the bundle status
+func (b *Bundle) release(ctx context.Context) error {
+	a := b.Artifact()
+	if a == nil || a.Etag == b.deployed {
+		return nil
+	}
+
+	if !b.isLeader() {
+		b.Logger.Debug("skipping deployment of bundle %s, node is not the leader", b.Name)
+		return nil
+	}
+
+	err := b.deploy(ctx, a)
+	b.recordDeploy(err)
+	if err != nil {
+		return err
+	}
+
+	b.deployed = a.Etag
+
+	// if the bundle has not changed since it was first built
+	// ignore publishing updates
+	if a.Etag == b.initial {
+		return nil
+	}
+
+	// publish events on successful deployments
+	payload := []byte(fmt.Sprintf(`{"etag":%q}`, a.Etag))
+	for _, pub := range b.Publishers {
+		go pub.Publish(ctx, payload)
+	}
+
+	return nil
+}
+
+// deploy runs every deployer on the artifact and returns an error
+// describing each deployer that failed
+func (b *Bundle) deploy(ctx context.Context, a *Artifact) error {
+	names := []string{}
+	for name := range b.Deployers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bundle := &deployer.Bundle{
+		Name:     b.Name,
+		Revision: a.Revision,
+		Etag:     a.Etag,
+		Data:     a.Data,
+	}
+
+	failed := []string{}
+	for _, name := range names {
+		b.Logger.Debug("deploying bundle %s with deployer %s", b.Name, name)
+		if err := b.Deployers[name].Deploy(ctx, bundle); err != nil {
+			b.Logger.Error("deployer %s failed to deploy bundle %s: %s", name, b.Name, err)
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+
+		b.Logger.Info("deployer %s deployed bundle %s with etag %s", name, b.Name, a.Etag)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to deploy bundle %s: %s", b.Name, strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
 // Activate sets up the bundle, performs the initial build, and by
 // default starts polling the store and rebuilding periodically
 func (b *Bundle) Activate() error {
@@ -104,7 +279,22 @@ func (b *Bundle) Activate() error {
 		return fmt.Errorf("bundle %s already activated", b.Name)
 	}
 
-	b.dq = lane.NewCappedDeque(1)
+	// serve the cached artifact until the first build completes. the
+	// bundle may already have been rebuilt by a callback
+	b.mx.Lock()
+	if b.CacheDir != "" && b.Artifact() == nil {
+		a, err := b.loadCache()
+		if err != nil {
+			if !os.IsNotExist(err) {
+				b.Logger.Warn("failed to load bundle %s from cache directory %s: %s", b.Name, b.CacheDir, err)
+			}
+		} else {
+			b.Logger.Info("loaded bundle %s with etag %s from cache directory %s", b.Name, a.Etag, b.CacheDir)
+			b.artifact.Store(a)
+			b.initial = a.Etag
+		}
+	}
+	b.mx.Unlock()
 
 	ctx, b.pollCancel = context.WithCancel(context.Background())
 	go b.loop(ctx)
@@ -127,6 +317,32 @@ func (b *Bundle) Deactivate() error {
 	return nil
 }
 
+// poll rebuilds the bundle unless the store reports that its revision has
+// not changed since the last successful poll
+func (b *Bundle) poll(ctx context.Context) error {
+	r, ok := b.Store.(store.Revisioner)
+	if !ok {
+		return b.Rebuild(ctx)
+	}
+
+	revision, err := r.Revision(ctx)
+	if err != nil {
+		b.Logger.Warn("failed to get the store revision for bundle %s: %s", b.Name, err)
+		return b.Rebuild(ctx)
+	}
+
+	b.mx.Lock()
+	unchanged := revision != "" && revision == b.polled && b.Artifact() != nil
+	b.mx.Unlock()
+
+	if unchanged {
+		b.Logger.Debug("store revision %s is unchanged, skipping rebuild of bundle %s", revision, b.Name)
+		return nil
+	}
+
+	return b.rebuild(ctx, revision)
+}
+
 // loop performs a polling operation if it is enabled. loop will always
 // run at least once to perform the initial build of the bundle
 func (b *Bundle) loop(ctx context.Context) {
@@ -139,7 +355,7 @@ func (b *Bundle) loop(ctx context.Context) {
 			return
 		}
 
-		err := b.Rebuild(ctx)
+		err := b.poll(ctx)
 
 		// if polling is disabled, dont try to rebuild
 		if b.Config.Polling.Disable {
@@ -0,0 +1,412 @@
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/bundle"
+	"github.com/bhoriuchi/opa-bundle-server/core/config"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/deployer"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	opabundle "github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+// testStore builds a bundle with a single policy and reports a fixed revision
+type testStore struct {
+	mx       sync.Mutex
+	policy   string
+	revision string
+	err      error
+}
+
+func (s *testStore) Connect(ctx context.Context) error    { return nil }
+func (s *testStore) Disconnect(ctx context.Context) error { return nil }
+
+func (s *testStore) Revision(ctx context.Context) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.revision, nil
+}
+
+func (s *testStore) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return store.Archive(ctx, store.EntryList{
+		{Key: "policy.rego", Value: []byte(s.policy)},
+	})
+}
+
+// buildStore builds its files with the build options of the bundle
+type buildStore struct {
+	files map[string]string
+}
+
+func (s *buildStore) Connect(ctx context.Context) error    { return nil }
+func (s *buildStore) Disconnect(ctx context.Context) error { return nil }
+
+func (s *buildStore) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	list := store.EntryList{}
+	for key, value := range s.files {
+		list = append(list, &store.Entry{Key: key, Value: []byte(value)})
+	}
+
+	archive, err := store.Archive(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := opabundle.NewTarballLoaderWithBaseURL(bytes.NewReader(archive), "")
+	return store.Bundle(ctx, loader, opts)
+}
+
+// testDeployer records deployments and fails the first fail deployments
+type testDeployer struct {
+	mx       sync.Mutex
+	fail     int
+	deployed []string
+}
+
+func (d *testDeployer) Deploy(ctx context.Context, b *deployer.Bundle) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.fail > 0 {
+		d.fail--
+		return fmt.Errorf("deployment failed")
+	}
+
+	d.deployed = append(d.deployed, b.Etag)
+	return nil
+}
+
+func (d *testDeployer) count() int {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return len(d.deployed)
+}
+
+func newBundle(s store.Store, deployers map[string]deployer.Deployer) *bundle.Bundle {
+	return &bundle.Bundle{
+		Name:      "authz",
+		Logger:    logging.NewNoOpLogger(),
+		Store:     s,
+		Deployers: deployers,
+		Config: &config.Bundle{
+			Polling: config.Polling{
+				MinDelaySeconds: 60,
+				MaxDelaySeconds: 60,
+			},
+		},
+	}
+}
+
+// waitFor waits for the condition to be true
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPollRetriesFailedDeployments checks that an unchanged store revision
+// does not skip the retry of a failed deployment
+func TestPollRetriesFailedDeployments(t *testing.T) {
+	dep := &testDeployer{fail: 1}
+	b := newBundle(
+		&testStore{policy: "package authz", revision: "1"},
+		map[string]deployer.Deployer{"test": dep},
+	)
+
+	if err := b.Activate(); err != nil {
+		t.Fatalf("failed to activate bundle: %s", err)
+	}
+	defer b.Deactivate()
+
+	waitFor(t, "expected the failed deployment to be retried", func() bool {
+		return dep.count() == 1
+	})
+}
+
+// TestFailedTestsStatus checks that failing rego tests fail the
+// build and are reported in the bundle status
+func TestFailedTestsStatus(t *testing.T) {
+	b := newBundle(&buildStore{files: map[string]string{
+		"authz/policy.rego":      "package authz\n\nallow { input.admin }",
+		"authz/policy_test.rego": "package authz\n\ntest_allow { allow with input as {\"admin\": false} }",
+	}}, nil)
+	b.Config.Test.Enabled = true
+
+	if err := b.Activate(); err != nil {
+		t.Fatalf("failed to activate bundle: %s", err)
+	}
+	defer b.Deactivate()
+
+	waitFor(t, "expected the failing test to fail the build", func() bool {
+		return b.Status().Failure != nil
+	})
+
+	status := b.Status()
+	if status.Serving != nil {
+		t.Errorf("expected no bundle to be served")
+	}
+
+	if len(status.Failure.FailedTests) != 1 || status.Failure.FailedTests[0] != "data.authz.test_allow" {
+		t.Errorf("expected the failed test in the status, got %+v", status.Failure)
+	}
+}
+
+// TestMissingSchemaFile checks that a schema file that cannot
+// be read fails the build
+func TestMissingSchemaFile(t *testing.T) {
+	b := newBundle(&buildStore{files: map[string]string{
+		"users/data.json": `{"admins": ["alice"]}`,
+	}}, nil)
+	b.Config.Schemas = map[string]string{
+		"users": filepath.Join(t.TempDir(), "missing.json"),
+	}
+
+	if err := b.Activate(); err != nil {
+		t.Fatalf("failed to activate bundle: %s", err)
+	}
+	defer b.Deactivate()
+
+	waitFor(t, "expected the missing schema file to fail the build", func() bool {
+		return b.Status().Failure != nil
+	})
+
+	if failure := b.Status().Failure; !strings.Contains(failure.Error, "failed to read schema file for users") {
+		t.Errorf("expected a missing schema file error, got %s", failure.Error)
+	}
+}
+
+// testPublisher records the published payloads
+type testPublisher struct {
+	published chan string
+}
+
+func (p *testPublisher) Connect(ctx context.Context) error    { return nil }
+func (p *testPublisher) Disconnect(ctx context.Context) error { return nil }
+
+func (p *testPublisher) Publish(ctx context.Context, payload []byte) error {
+	p.published <- string(payload)
+	return nil
+}
+
+func (s *testStore) setPolicy(policy string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.policy = policy
+}
+
+// TestDeployFailureStatus checks that failed deployments are reported in
+// the bundle status until a deployment succeeds
+func TestDeployFailureStatus(t *testing.T) {
+	ctx := context.Background()
+	dep := &testDeployer{fail: 2}
+	b := newBundle(
+		&testStore{policy: "package authz"},
+		map[string]deployer.Deployer{"test": dep},
+	)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := b.Rebuild(ctx); err == nil {
+			t.Fatal("expected the failed deployment to be returned")
+		}
+
+		failure := b.Status().DeployFailure
+		if failure == nil {
+			t.Fatal("expected the deployment failure in the status")
+		}
+
+		if failure.Attempts != attempt || !strings.Contains(failure.Error, "test: deployment failed") {
+			t.Errorf("unexpected deployment failure %+v", failure)
+		}
+	}
+
+	// the build itself succeeded and is served
+	status := b.Status()
+	if status.Failure != nil || status.Serving == nil {
+		t.Errorf("expected the bundle to be built, got %+v", status)
+	}
+
+	if err := b.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	if failure := b.Status().DeployFailure; failure != nil {
+		t.Errorf("expected the deployment failure to be cleared, got %+v", failure)
+	}
+
+	if dep.count() != 1 {
+		t.Errorf("expected 1 deployment, got %d", dep.count())
+	}
+}
+
+// TestReleaseLeader checks that only the leader deploys and publishes
+// bundles and that unchanged bundles are not deployed again
+func TestReleaseLeader(t *testing.T) {
+	ctx := context.Background()
+	s := &testStore{policy: "package authz"}
+	dep := &testDeployer{}
+	pub := &testPublisher{published: make(chan string, 10)}
+
+	var (
+		mx     sync.Mutex
+		leader bool
+	)
+	setLeader := func(l bool) {
+		mx.Lock()
+		defer mx.Unlock()
+		leader = l
+	}
+
+	b := newBundle(s, map[string]deployer.Deployer{"test": dep})
+	b.Publishers = []publisher.Publisher{pub}
+	b.Leader = func() bool {
+		mx.Lock()
+		defer mx.Unlock()
+		return leader
+	}
+
+	if err := b.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	if b.Artifact() == nil {
+		t.Fatal("expected followers to build the bundle")
+	}
+
+	if dep.count() != 0 {
+		t.Errorf("expected followers to not deploy, got %d deployments", dep.count())
+	}
+
+	// a new leader catches up on the current bundle
+	setLeader(true)
+	if err := b.Deploy(ctx); err != nil {
+		t.Fatalf("failed to deploy bundle: %s", err)
+	}
+
+	if err := b.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	if dep.count() != 1 {
+		t.Errorf("expected 1 deployment of the unchanged bundle, got %d", dep.count())
+	}
+
+	// the initial bundle is not published, changes are
+	select {
+	case payload := <-pub.published:
+		t.Errorf("expected the initial bundle to not be published, got %s", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.setPolicy("package authz\n\nallow = true")
+	if err := b.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	if dep.count() != 2 {
+		t.Errorf("expected the changed bundle to be deployed, got %d deployments", dep.count())
+	}
+
+	select {
+	case payload := <-pub.published:
+		if !strings.Contains(payload, b.Etag()) {
+			t.Errorf("expected the etag to be published, got %s", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the changed bundle to be published")
+	}
+}
+
+// TestInherit checks that the built bundle is inherited and that the
+// deployment state is only kept when the deployers are the same
+func TestInherit(t *testing.T) {
+	ctx := context.Background()
+	s := &testStore{policy: "package authz"}
+	dep := &testDeployer{}
+	deployers := map[string]deployer.Deployer{"test": dep}
+
+	prev := newBundle(s, deployers)
+	if err := prev.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	same := newBundle(s, deployers)
+	same.Inherit(prev)
+
+	if same.Etag() != prev.Etag() {
+		t.Errorf("expected the artifact to be inherited")
+	}
+
+	if err := same.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	if dep.count() != 1 {
+		t.Errorf("expected the inherited deployment to not be repeated, got %d deployments", dep.count())
+	}
+
+	other := &testDeployer{}
+	changed := newBundle(s, map[string]deployer.Deployer{"test": other})
+	changed.Inherit(prev)
+
+	if err := changed.Rebuild(ctx); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	if other.count() != 1 {
+		t.Errorf("expected new deployers to deploy the bundle, got %d deployments", other.count())
+	}
+}
+
+// TestCache checks that a cached bundle is served on activation
+// until the bundle can be rebuilt
+func TestCache(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	built := newBundle(&testStore{policy: "package authz"}, nil)
+	built.CacheDir = cacheDir
+	if err := built.Rebuild(context.Background()); err != nil {
+		t.Fatalf("failed to rebuild bundle: %s", err)
+	}
+
+	cached := newBundle(&testStore{err: fmt.Errorf("store unavailable")}, nil)
+	cached.CacheDir = cacheDir
+	if err := cached.Activate(); err != nil {
+		t.Fatalf("failed to activate bundle: %s", err)
+	}
+	defer cached.Deactivate()
+
+	a := cached.Artifact()
+	if a == nil || a.Etag != built.Etag() || !bytes.Equal(a.Data, built.Data()) {
+		t.Fatalf("expected the cached bundle to be served")
+	}
+
+	waitFor(t, "expected the failed build to be recorded", func() bool {
+		return cached.Status().Failure != nil
+	})
+
+	if cached.Etag() != built.Etag() {
+		t.Errorf("expected the cached bundle to be served after a failed build")
+	}
+}
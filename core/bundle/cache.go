@@ -0,0 +1,62 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+)
+
+// cacheFiles returns the archive and metadata file paths for the bundle
+func (b *Bundle) cacheFiles() (string, string) {
+	file := filepath.Join(b.CacheDir, b.Name+".tar.gz")
+	return file, file + ".json"
+}
+
+// loadCache loads the last artifact written to the cache directory
+func (b *Bundle) loadCache() (*Artifact, error) {
+	file, metaFile := b.cacheFiles()
+
+	meta, err := ioutil.ReadFile(metaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Artifact{}
+	if err := json.Unmarshal(meta, a); err != nil {
+		return nil, err
+	}
+
+	if a.Data, err = ioutil.ReadFile(file); err != nil {
+		return nil, err
+	}
+
+	// make sure the archive was not modified or partially written
+	if etag := NewArtifact(a.Data, "").Etag; etag != a.Etag {
+		return nil, fmt.Errorf("cached bundle etag %s does not match metadata etag %s", etag, a.Etag)
+	}
+
+	return a, nil
+}
+
+// writeCache writes the artifact and its metadata to the cache directory
+func (b *Bundle) writeCache(a *Artifact) error {
+	if err := os.MkdirAll(b.CacheDir, 0755); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	file, metaFile := b.cacheFiles()
+	if err := utils.WriteFileAtomic(file, a.Data, 0644); err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(metaFile, meta, 0644)
+}
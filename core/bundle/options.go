@@ -0,0 +1,111 @@
+package bundle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/config"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// buildOptions creates the store build options from the bundle config.
+// Keys are loaded on every build so that rotated keys are picked up
+func (b *Bundle) buildOptions() (*store.BuildOptions, error) {
+	cfg := b.Config.Compile
+	opts := &store.BuildOptions{
+		Target:            cfg.Target,
+		OptimizationLevel: cfg.OptimizationLevel,
+		Entrypoints:       cfg.Entrypoints,
+		PruneUnused:       cfg.PruneUnused,
+		Revision:          cfg.Revision,
+		Roots:             cfg.Roots,
+	}
+
+	if cfg.CapabilitiesFile != "" {
+		capabilities, err := loadCapabilities(cfg.CapabilitiesFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capabilities file for bundle %s: %s", b.Name, err)
+		}
+		opts.Capabilities = capabilities
+	}
+
+	if len(b.Config.Schemas) > 0 {
+		schemas, err := loadSchemas(b.Config.Schemas)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schemas for bundle %s: %s", b.Name, err)
+		}
+		opts.Schemas = schemas
+	}
+
+	if b.Config.Test.Enabled {
+		opts.Test = &store.TestOptions{
+			CoverageThreshold: b.Config.Test.CoverageThreshold,
+		}
+	}
+
+	if b.Config.Signing != nil {
+		signing, err := signingOptions(b.Config.Signing)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing configuration for bundle %s: %s", b.Name, err)
+		}
+		opts.Signing = signing
+	}
+
+	return opts, nil
+}
+
+// loadCapabilities loads the capabilities json file
+func loadCapabilities(file string) (*ast.Capabilities, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ast.LoadCapabilitiesJSON(f)
+}
+
+// loadSchemas reads the schema file for each data path
+func loadSchemas(files map[string]string) (map[string][]byte, error) {
+	schemas := map[string][]byte{}
+	for p, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file for %s: %s", p, err)
+		}
+		schemas[p] = content
+	}
+
+	return schemas, nil
+}
+
+// signingOptions loads the signing key and creates the signing options
+func signingOptions(cfg *config.Signing) (*store.SigningOptions, error) {
+	var key string
+
+	switch {
+	case cfg.KeyFile != "":
+		content, err := ioutil.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key file: %s", err)
+		}
+		key = string(content)
+	case cfg.KeyEnv != "":
+		key = os.Getenv(cfg.KeyEnv)
+		if key == "" {
+			return nil, fmt.Errorf("signing key environment variable %s is not set", cfg.KeyEnv)
+		}
+	default:
+		return nil, fmt.Errorf("a key_file or key_env is required")
+	}
+
+	return &store.SigningOptions{
+		KeyID:      cfg.KeyID,
+		Algorithm:  cfg.Algorithm,
+		Key:        key,
+		ClaimsFile: cfg.ClaimsFile,
+		Exclude:    cfg.ExcludeFiles,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package bundle
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+)
+
+// Status is the build and deployment status of a bundle
+type Status struct {
+	Name          string     `json:"name"`
+	Serving       *Artifact  `json:"serving"`
+	Failure       *Failure   `json:"failure,omitempty"`
+	DeployFailure *Failure   `json:"deploy_failure,omitempty"`
+	LastAttempt   *time.Time `json:"last_attempt,omitempty"`
+}
+
+// Failure describes the latest failed build or deployment of a bundle.
+// Attempts is the number of consecutive attempts that have failed
+type Failure struct {
+	Error       string    `json:"error"`
+	FailedAt    time.Time `json:"failed_at"`
+	Attempts    int       `json:"attempts"`
+	FailedTests []string  `json:"failed_tests,omitempty"`
+}
+
+// Status returns the build and deployment status of the bundle
+func (b *Bundle) Status() *Status {
+	b.sx.Lock()
+	defer b.sx.Unlock()
+
+	status := &Status{
+		Name:    b.Name,
+		Serving: b.Artifact(),
+	}
+
+	if !b.attempted.IsZero() {
+		attempted := b.attempted
+		status.LastAttempt = &attempted
+	}
+
+	if b.failure != nil {
+		failure := *b.failure
+		status.Failure = &failure
+	}
+
+	if b.deployFailure != nil {
+		failure := *b.deployFailure
+		status.DeployFailure = &failure
+	}
+
+	return status
+}
+
+// recordBuild records the result of a build attempt
+func (b *Bundle) recordBuild(err error) {
+	b.sx.Lock()
+	defer b.sx.Unlock()
+
+	b.attempted = time.Now().UTC()
+
+	if err == nil {
+		b.failure = nil
+		return
+	}
+
+	attempts := 1
+	if b.failure != nil {
+		attempts = b.failure.Attempts + 1
+	}
+
+	b.failure = &Failure{
+		Error:    err.Error(),
+		FailedAt: b.attempted,
+		Attempts: attempts,
+	}
+
+	var testErr *store.TestError
+	if errors.As(err, &testErr) {
+		b.failure.FailedTests = testErr.Failed
+	}
+}
+
+// recordDeploy records the result of a deployment attempt
+func (b *Bundle) recordDeploy(err error) {
+	b.sx.Lock()
+	defer b.sx.Unlock()
+
+	if err == nil {
+		b.deployFailure = nil
+		return
+	}
+
+	attempts := 1
+	if b.deployFailure != nil {
+		attempts = b.deployFailure.Attempts + 1
+	}
+
+	b.deployFailure = &Failure{
+		Error:    err.Error(),
+		FailedAt: time.Now().UTC(),
+		Attempts: attempts,
+	}
+}
@@ -62,6 +62,7 @@ func initServerStartCmd() *cobra.Command {
 	flags.StringVarP(&configFile, "config", "c", os.Getenv("OPA_BUNDLE_SERVER_CONFIG"), "Location of the config file")
 	flags.StringVarP(&logLevel, "log-level", "l", os.Getenv("OPA_BUNDLE_SERVER_LOG_LEVEL"), "Log level (error, info, warn, debug)")
 	flags.StringVar(&logFormat, "log-format", os.Getenv("OPA_BUNDLE_SERVER_LOG_FORMAT"), "Log format (text, json-pretty, or json)")
+	flags.BoolVarP(&watch, "watch", "w", os.Getenv("OPA_BUNDLE_SERVER_WATCH") == "true", "Reload the config file when it changes")
 
 	return cmd
 }
@@ -0,0 +1,88 @@
+package etcd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	DefaultDialTimeout = "5s"
+)
+
+type Client struct {
+	config *Config
+	client *clientv3.Client
+}
+
+func (c *Client) Etcd() *clientv3.Client {
+	return c.client
+}
+
+// Close closes the client
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+func NewClient(conf *Config) (*Client, error) {
+	var err error
+
+	c := &Client{
+		config: conf,
+	}
+
+	if c.client, err = conf.Client(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type Config struct {
+	Endpoints   []string         `yaml:"endpoints" json:"endpoints"`
+	Username    string           `yaml:"username" json:"username"`
+	Password    string           `yaml:"password" json:"password"`
+	PasswordEnv string           `yaml:"password_env" json:"password_env"`
+	DialTimeout string           `yaml:"dial_timeout" json:"dial_timeout"`
+	TLS         *utils.TLSConfig `yaml:"tls" json:"tls"`
+}
+
+// Client creates a new etcd client from the config
+func (c *Config) Client() (*clientv3.Client, error) {
+	if len(c.Endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd endpoints provided")
+	}
+
+	dialTimeout := c.DialTimeout
+	if dialTimeout == "" {
+		dialTimeout = DefaultDialTimeout
+	}
+
+	timeout, err := time.ParseDuration(dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dial timeout: %s", err)
+	}
+
+	tlsConfig, err := c.TLS.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls configuration: %s", err)
+	}
+
+	password := c.Password
+	if c.PasswordEnv != "" {
+		if password = os.Getenv(c.PasswordEnv); password == "" {
+			return nil, fmt.Errorf("password environment variable %s is not set", c.PasswordEnv)
+		}
+	}
+
+	return clientv3.New(clientv3.Config{
+		Endpoints:   c.Endpoints,
+		Username:    c.Username,
+		Password:    password,
+		DialTimeout: timeout,
+		TLS:         tlsConfig,
+	})
+}
@@ -0,0 +1,50 @@
+// Package etcdtest runs an embedded etcd server for tests
+package etcdtest
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+const (
+	startTimeout = 30 * time.Second
+)
+
+// Start starts an embedded etcd server listening on random localhost
+// ports and returns a client configuration for it. The server is
+// stopped when the test completes
+func Start(t *testing.T) *etcd.Config {
+	t.Helper()
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	clientURL, _ := url.Parse("http://127.0.0.1:0")
+	peerURL, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls = []url.URL{*clientURL}
+	cfg.ACUrls = []url.URL{*clientURL}
+	cfg.LPUrls = []url.URL{*peerURL}
+	cfg.APUrls = []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("failed to start embedded etcd: %s", err)
+	}
+	t.Cleanup(server.Close)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(startTimeout):
+		t.Fatalf("embedded etcd did not start within %s", startTimeout)
+	}
+
+	return &etcd.Config{
+		Endpoints: []string{server.Clients[0].Addr().String()},
+	}
+}
@@ -0,0 +1,137 @@
+package nats
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+const (
+	DefaultReconnectWait = "2s"
+)
+
+type Client struct {
+	config *Config
+	conn   *natsgo.Conn
+}
+
+func (c *Client) NATS() *natsgo.Conn {
+	return c.conn
+}
+
+// JetStream returns a jetstream context for the connection
+func (c *Client) JetStream() (natsgo.JetStreamContext, error) {
+	return c.conn.JetStream()
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.conn.Close()
+	return nil
+}
+
+// NewClient connects to the nats servers
+func NewClient(conf *Config) (*Client, error) {
+	c := &Client{
+		config: conf,
+	}
+
+	opts, err := conf.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	url := conf.URL
+	if url == "" {
+		url = natsgo.DefaultURL
+	}
+
+	if c.conn, err = natsgo.Connect(url, opts...); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Config configures a nats connection. The url can be a comma separated
+// list of servers. Only one of token, username and password, creds
+// file, or nkey seed file should be set
+type Config struct {
+	URL           string           `yaml:"url" json:"url"`
+	Name          string           `yaml:"name" json:"name"`
+	Token         string           `yaml:"token" json:"token"`
+	TokenEnv      string           `yaml:"token_env" json:"token_env"`
+	Username      string           `yaml:"username" json:"username"`
+	Password      string           `yaml:"password" json:"password"`
+	PasswordEnv   string           `yaml:"password_env" json:"password_env"`
+	CredsFile     string           `yaml:"creds_file" json:"creds_file"`
+	NKeyFile      string           `yaml:"nkey_file" json:"nkey_file"`
+	ReconnectWait string           `yaml:"reconnect_wait" json:"reconnect_wait"`
+	TLS           *utils.TLSConfig `yaml:"tls" json:"tls"`
+}
+
+// Options returns the connection options for the config. The
+// connection is retried indefinitely once established
+func (c *Config) Options() ([]natsgo.Option, error) {
+	reconnectWait := c.ReconnectWait
+	if reconnectWait == "" {
+		reconnectWait = DefaultReconnectWait
+	}
+
+	wait, err := time.ParseDuration(reconnectWait)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconnect wait: %s", err)
+	}
+
+	opts := []natsgo.Option{
+		natsgo.MaxReconnects(-1),
+		natsgo.ReconnectWait(wait),
+	}
+
+	if c.Name != "" {
+		opts = append(opts, natsgo.Name(c.Name))
+	}
+
+	token := c.Token
+	if c.TokenEnv != "" {
+		if token = os.Getenv(c.TokenEnv); token == "" {
+			return nil, fmt.Errorf("token environment variable %s is not set", c.TokenEnv)
+		}
+	}
+
+	password := c.Password
+	if c.PasswordEnv != "" {
+		if password = os.Getenv(c.PasswordEnv); password == "" {
+			return nil, fmt.Errorf("password environment variable %s is not set", c.PasswordEnv)
+		}
+	}
+
+	switch {
+	case token != "":
+		opts = append(opts, natsgo.Token(token))
+	case c.Username != "":
+		opts = append(opts, natsgo.UserInfo(c.Username, password))
+	case c.CredsFile != "":
+		opts = append(opts, natsgo.UserCredentials(c.CredsFile))
+	case c.NKeyFile != "":
+		opt, err := natsgo.NkeyOptionFromSeed(c.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nkey seed file: %s", err)
+		}
+		opts = append(opts, opt)
+	}
+
+	tlsConfig, err := c.TLS.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls configuration: %s", err)
+	}
+
+	if tlsConfig != nil {
+		opts = append(opts, natsgo.Secure(tlsConfig))
+	}
+
+	return opts, nil
+}
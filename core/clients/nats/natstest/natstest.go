@@ -0,0 +1,47 @@
+// Package natstest runs an embedded nats server for tests
+package natstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/nats"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+const (
+	startTimeout = 10 * time.Second
+)
+
+// Start starts an embedded nats server with jetstream enabled on a
+// random localhost port and returns a client configuration for it.
+// When token is set clients must authenticate with it. The server
+// is stopped when the test completes
+func Start(t *testing.T, token string) *nats.Config {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{
+		Host:          "127.0.0.1",
+		Port:          server.RANDOM_PORT,
+		JetStream:     true,
+		StoreDir:      t.TempDir(),
+		Authorization: token,
+		NoLog:         true,
+		NoSigs:        true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create embedded nats server: %s", err)
+	}
+
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	if !s.ReadyForConnections(startTimeout) {
+		t.Fatalf("embedded nats server did not start within %s", startTimeout)
+	}
+
+	return &nats.Config{
+		URL:   s.ClientURL(),
+		Token: token,
+	}
+}
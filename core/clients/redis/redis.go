@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const (
+	DefaultDialTimeout = "5s"
+)
+
+type Client struct {
+	config *Config
+	client goredis.UniversalClient
+}
+
+func (c *Client) Redis() goredis.UniversalClient {
+	return c.client
+}
+
+// DB returns the selected database
+func (c *Client) DB() int {
+	return c.config.DB
+}
+
+// Close closes the client
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+func NewClient(conf *Config) (*Client, error) {
+	var err error
+
+	c := &Client{
+		config: conf,
+	}
+
+	if c.client, err = conf.Client(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Config configures a redis client. A single address connects to a
+// standalone server, multiple addresses to a cluster, and a master
+// name to the sentinels at the addresses
+type Config struct {
+	Address     string           `yaml:"address" json:"address"`
+	Addresses   []string         `yaml:"addresses" json:"addresses"`
+	MasterName  string           `yaml:"master_name" json:"master_name"`
+	Username    string           `yaml:"username" json:"username"`
+	Password    string           `yaml:"password" json:"password"`
+	PasswordEnv string           `yaml:"password_env" json:"password_env"`
+	DB          int              `yaml:"db" json:"db"`
+	DialTimeout string           `yaml:"dial_timeout" json:"dial_timeout"`
+	TLS         *utils.TLSConfig `yaml:"tls" json:"tls"`
+}
+
+// Client creates a new redis client from the config
+func (c *Config) Client() (goredis.UniversalClient, error) {
+	addrs := c.Addresses
+	if c.Address != "" {
+		addrs = append([]string{c.Address}, addrs...)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no redis address provided")
+	}
+
+	dialTimeout := c.DialTimeout
+	if dialTimeout == "" {
+		dialTimeout = DefaultDialTimeout
+	}
+
+	timeout, err := time.ParseDuration(dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dial timeout: %s", err)
+	}
+
+	tlsConfig, err := c.TLS.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls configuration: %s", err)
+	}
+
+	password := c.Password
+	if c.PasswordEnv != "" {
+		if password = os.Getenv(c.PasswordEnv); password == "" {
+			return nil, fmt.Errorf("password environment variable %s is not set", c.PasswordEnv)
+		}
+	}
+
+	return goredis.NewUniversalClient(&goredis.UniversalOptions{
+		Addrs:       addrs,
+		MasterName:  c.MasterName,
+		Username:    c.Username,
+		Password:    password,
+		DB:          c.DB,
+		DialTimeout: timeout,
+		TLSConfig:   tlsConfig,
+	}), nil
+}
+
+// EscapePattern escapes glob characters so that s is
+// matched literally in SCAN and PSUBSCRIBE patterns
+func EscapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -26,7 +26,8 @@ type Config struct {
 }
 
 type Server struct {
-	Address string `json:"address" yaml:"address"`
+	Address  string `json:"address" yaml:"address"`
+	CacheDir string `json:"cache_dir" yaml:"cache_dir"`
 }
 
 type Lock struct {
@@ -66,6 +67,41 @@ type Bundle struct {
 	Subscribers []string `json:"subscribers" yaml:"subscribers"`
 	Deployers   []string `json:"deployers" yaml:"deployers"`
 	Polling     Polling  `json:"polling" yaml:"polling"`
+	Compile     Compile  `json:"compile" yaml:"compile"`
+	Test        Test     `json:"test" yaml:"test"`
+	Signing     *Signing `json:"signing" yaml:"signing"`
+
+	// Schemas maps data paths to the json schema files
+	// their documents are validated against
+	Schemas map[string]string `json:"schemas" yaml:"schemas"`
+}
+
+// Compile configures how the bundle is compiled
+type Compile struct {
+	Target            string   `json:"target" yaml:"target"`
+	OptimizationLevel int      `json:"optimization_level" yaml:"optimization_level"`
+	Entrypoints       []string `json:"entrypoints" yaml:"entrypoints"`
+	CapabilitiesFile  string   `json:"capabilities_file" yaml:"capabilities_file"`
+	PruneUnused       bool     `json:"prune_unused" yaml:"prune_unused"`
+	Revision          string   `json:"revision" yaml:"revision"`
+	Roots             []string `json:"roots" yaml:"roots"`
+}
+
+// Test configures running the rego unit tests before serving the bundle
+type Test struct {
+	Enabled           bool    `json:"enabled" yaml:"enabled"`
+	CoverageThreshold float64 `json:"coverage_threshold" yaml:"coverage_threshold"`
+}
+
+// Signing configures bundle signing. The key is read from key_file
+// or the environment variable named by key_env
+type Signing struct {
+	KeyID        string   `json:"key_id" yaml:"key_id"`
+	Algorithm    string   `json:"algorithm" yaml:"algorithm"`
+	KeyFile      string   `json:"key_file" yaml:"key_file"`
+	KeyEnv       string   `json:"key_env" yaml:"key_env"`
+	ClaimsFile   string   `json:"claims_file" yaml:"claims_file"`
+	ExcludeFiles []string `json:"exclude_files" yaml:"exclude_files"`
 }
 
 type Polling struct {
@@ -1,11 +1,24 @@
 package server
 
 import (
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/deployer/directory"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/lock/consul"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/lock/etcd"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/lock/redis"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/publisher/consul"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/publisher/nats"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/publisher/redis"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/consul"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/directory"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/etcd"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/git"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/http"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/redis"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/store/sql"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/consul"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/etcd"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/nats"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/postgres"
+	_ "github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/redis"
 	_ "github.com/bhoriuchi/opa-bundle-server/plugins/webhook/gogs"
 )
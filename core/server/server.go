@@ -43,6 +43,15 @@ func (s *Server) Start(ctx context.Context) error {
 			s.service.HandleWebhook(name, w, r)
 		})
 
+		r.Get("/status", func(w http.ResponseWriter, r *http.Request) {
+			s.service.HandleStatuses(w, r)
+		})
+
+		r.Get("/bundles/{name}/status", func(w http.ResponseWriter, r *http.Request) {
+			name := chi.URLParam(r, "name")
+			s.service.HandleStatus(name, w, r)
+		})
+
 		r.Get("/bundles/{name}", func(w http.ResponseWriter, r *http.Request) {
 			name := chi.URLParam(r, "name")
 			s.service.Logger().Debug("bundle request for %s", name)
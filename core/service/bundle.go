@@ -2,82 +2,182 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/bhoriuchi/opa-bundle-server/core/bundle"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/deployer"
 	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher"
 )
 
+// Bundles returns the bundles that are currently registered
 func (s *Service) Bundles() map[string]*bundle.Bundle {
-	return s.bundles
+	return s.current().bundles
 }
 
-// LoadBundles loads bundles
-func (s *Service) LoadBundles(ctx context.Context) error {
+// LoadBundles loads bundles. Bundles are activated once all of the
+// components have loaded successfully. Bundles whose configuration and
+// plugins are unchanged are reused and changed bundles continue serving
+// the previously built bundle until they are rebuilt
+func (s *Service) LoadBundles(ctx context.Context, c, prev *components) error {
 	var ok bool
 
-	if s.bundles != nil {
-		for name, b := range s.bundles {
-			if err := b.Deactivate(); err != nil {
-				s.logger.Error("failed to deactivate bundle %s", name)
-			}
-		}
+	cacheDir := ""
+	if c.config.Server != nil {
+		cacheDir = c.config.Server.CacheDir
 	}
 
-	for name, config := range s.config.Bundles {
+	for name, config := range c.config.Bundles {
 		b := &bundle.Bundle{
 			Name:        name,
 			Logger:      s.logger,
 			Webhooks:    config.Webhooks,
 			Subscribers: config.Subscribers,
 			Publishers:  []publisher.Publisher{},
+			Deployers:   map[string]deployer.Deployer{},
 			Config:      config,
+			Leader:      s.IsLeader,
+			CacheDir:    cacheDir,
 		}
 
 		// add the store to the bundle
-		if b.Store, ok = s.stores[config.Store]; !ok {
+		if b.Store, ok = c.stores[config.Store]; !ok {
 			return fmt.Errorf("store %s for bundle %s not found", config.Store, name)
 		}
 
 		// add the publishers to the bundle
 		for _, pubName := range config.Publishers {
-			pub, ok := s.publishers[pubName]
+			pub, ok := c.publishers[pubName]
 			if !ok {
 				return fmt.Errorf("publisher %s for bundle %s not found", pubName, name)
 			}
 			b.Publishers = append(b.Publishers, pub)
 		}
 
-		// activate the bundle
-		if err := b.Activate(); err != nil {
-			s.logger.Error("failed to activate bundle %s", name)
+		// add the deployers to the bundle
+		for _, depName := range config.Deployers {
+			dep, ok := c.deployers[depName]
+			if !ok {
+				return fmt.Errorf("deployer %s for bundle %s not found", depName, name)
+			}
+			b.Deployers[depName] = dep
+		}
+
+		if existing, ok := prev.bundles[name]; ok {
+			if bundleUnchanged(existing, b) {
+				s.logger.Debug("bundle %s is unchanged", name)
+				c.bundles[name] = existing
+				continue
+			}
+
+			b.Inherit(existing)
 		}
 
 		s.logger.Info("registered bundle %s", name)
-		s.bundles[name] = b
+		c.bundles[name] = b
 	}
 	return nil
 }
 
+// bundleUnchanged returns true if both bundles have the same
+// configuration and use the same plugins
+func bundleUnchanged(prev, next *bundle.Bundle) bool {
+	if prev.Store != next.Store || prev.CacheDir != next.CacheDir || !unchanged(prev.Config, next.Config) {
+		return false
+	}
+
+	if len(prev.Publishers) != len(next.Publishers) || len(prev.Deployers) != len(next.Deployers) {
+		return false
+	}
+
+	for i, pub := range prev.Publishers {
+		if next.Publishers[i] != pub {
+			return false
+		}
+	}
+
+	for name, dep := range prev.Deployers {
+		if next.Deployers[name] != dep {
+			return false
+		}
+	}
+
+	return true
+}
+
 // HandleBundle handles bundle requests
 func (s *Service) HandleBundle(name string, w http.ResponseWriter, r *http.Request) {
-	b, ok := s.bundles[name]
+	b, ok := s.Bundles()[name]
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
+	// use a single artifact for the entire request so the
+	// etag always matches the data being served
+	a := b.Artifact()
+	if a == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("bundle %s has not been built", name)))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/tar+gzip")
-	w.Header().Set("ETag", b.Etag())
+	w.Header().Set("ETag", a.Etag)
 
 	etag := r.Header.Get("If-None-Match")
-	if etag != "" && etag == b.Etag() {
+	if etag != "" && etag == a.Etag {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	if _, err := w.Write(b.Data()); err != nil {
+	if _, err := w.Write(a.Data); err != nil {
 		s.logger.Error("failed to write bundle request for bundle %s: %s", name, err)
 	}
 }
+
+// HandleStatus handles bundle status requests
+func (s *Service) HandleStatus(name string, w http.ResponseWriter, r *http.Request) {
+	b, ok := s.Bundles()[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.writeJSON(w, b.Status())
+}
+
+// HandleStatuses handles requests for the status of all bundles
+func (s *Service) HandleStatuses(w http.ResponseWriter, r *http.Request) {
+	bundles := s.Bundles()
+
+	names := []string{}
+	for name := range bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := []*bundle.Status{}
+	for _, name := range names {
+		statuses = append(statuses, bundles[name].Status())
+	}
+
+	s.writeJSON(w, statuses)
+}
+
+// writeJSON writes a json response
+func (s *Service) writeJSON(w http.ResponseWriter, v interface{}) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(j); err != nil {
+		s.logger.Error("failed to write json response: %s", err)
+	}
+}
@@ -8,17 +8,20 @@ import (
 )
 
 // LoadDeployers loads and connects deployers
-func (s *Service) LoadDeployers(ctx context.Context) error {
-	s.deployers = map[string]deployer.Deployer{}
+func (s *Service) LoadDeployers(ctx context.Context, c, prev *components) error {
+	for name, cfg := range c.config.Deployers {
+		if existing, ok := prev.deployers[name]; ok && unchanged(prev.config.Deployers[name], cfg) {
+			s.logger.Debug("deployer %s is unchanged", name)
+			c.deployers[name] = existing
+			continue
+		}
 
-	// set up new deployer
-	for name, cfg := range s.config.Deployers {
 		newFunc, ok := deployer.Providers[cfg.Type]
 		if !ok {
 			return fmt.Errorf("invalid deployer provider type %s", cfg.Type)
 		}
 
-		deployer, err := newFunc(&deployer.Options{
+		dep, err := newFunc(&deployer.Options{
 			Name:   name,
 			Logger: s.logger,
 			Config: cfg.Config,
@@ -28,7 +31,7 @@ func (s *Service) LoadDeployers(ctx context.Context) error {
 		}
 
 		s.logger.Info("registering deployer %s", name)
-		s.deployers[name] = deployer
+		c.deployers[name] = dep
 	}
 
 	return nil
@@ -4,50 +4,96 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bhoriuchi/opa-bundle-server/core/bundle"
 	"github.com/bhoriuchi/opa-bundle-server/plugins/lock"
 )
 
-func (s *Service) Lock(ctx context.Context) error {
-	var err error
+// IsLeader returns true if this node holds the lock. When no lock
+// is configured every node is considered the leader
+func (s *Service) IsLeader() bool {
+	l := s.current().lock
+	if l == nil {
+		return true
+	}
 
-	if s.lock != nil {
-		if err := s.lock.Unlock(ctx); err != nil {
-			return err
-		}
+	return l.HasLock()
+}
 
-		if err := s.lock.Disconnect(ctx); err != nil {
-			return err
-		}
+// HandleLockChange performs a catch-up deployment of every bundle when
+// this node acquires the lock
+func (s *Service) HandleLockChange(hasLock bool) {
+	if !hasLock {
+		s.logger.Info("lock lost, deployments and publishes are disabled on this node")
+		return
+	}
 
-		s.lock = nil
+	s.logger.Info("lock acquired, deploying current bundles")
+	for name, b := range s.Bundles() {
+		go func(name string, b *bundle.Bundle) {
+			if err := b.Deploy(context.Background()); err != nil {
+				s.logger.Error("failed to deploy bundle %s after acquiring lock: %s", name, err)
+			}
+		}(name, b)
 	}
+}
 
-	if s.config.Lock == nil {
+// LoadLock creates and connects the lock
+func (s *Service) LoadLock(ctx context.Context, c, prev *components) (err error) {
+	if prev.lock != nil && unchanged(prev.config.Lock, c.config.Lock) {
+		s.logger.Debug("lock configuration is unchanged")
+		c.lock = prev.lock
+		return nil
+	}
+
+	if c.config.Lock == nil {
 		s.logger.Warn("no lock configuration specified. extra care should be taken when using deployers to prevent duplicate deployments")
 		return nil
 	}
 
-	newFunc, ok := lock.Providers[s.config.Lock.Type]
+	newFunc, ok := lock.Providers[c.config.Lock.Type]
 	if !ok {
-		return fmt.Errorf("lock provider %q not registered", s.config.Lock.Type)
+		return fmt.Errorf("lock provider %q not registered", c.config.Lock.Type)
 	}
 
-	if s.lock, err = newFunc(&lock.Options{
-		Config: s.config.Lock.Config,
-		Logger: s.logger,
-	}); err != nil {
+	l, err := newFunc(&lock.Options{
+		Config:   c.config.Lock.Config,
+		Logger:   s.logger,
+		Callback: s.HandleLockChange,
+	})
+	if err != nil {
 		return err
 	}
 
-	if err := s.lock.Connect(ctx); err != nil {
+	if err := l.Connect(ctx); err != nil {
 		return err
 	}
 
+	c.lock = l
+	return nil
+}
+
+// AcquireLock attempts to acquire the lock in the background
+func (s *Service) AcquireLock(l lock.Lock) {
+	if l == nil {
+		return
+	}
+
 	go func() {
-		if err := lock.Acquire(ctx, s.lock); err != nil {
+		if err := lock.Acquire(context.Background(), l); err != nil {
 			s.logger.Error("lock error: %s", err)
 		}
 	}()
+}
 
-	return nil
+// ReleaseLock unlocks and disconnects the lock
+func (s *Service) ReleaseLock(ctx context.Context, l lock.Lock) error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.Unlock(ctx); err != nil {
+		return err
+	}
+
+	return l.Disconnect(ctx)
 }
@@ -8,19 +8,14 @@ import (
 )
 
 // LoadPublishers loads and connects publishers
-func (s *Service) LoadPublishers(ctx context.Context) error {
-	if s.publishers != nil {
-		for name, pub := range s.publishers {
-			if err := pub.Disconnect(ctx); err != nil {
-				s.logger.Error("Failed to disconnect publisher %s: %s", name, err)
-			}
+func (s *Service) LoadPublishers(ctx context.Context, c, prev *components) error {
+	for name, cfg := range c.config.Publishers {
+		if existing, ok := prev.publishers[name]; ok && unchanged(prev.config.Publishers[name], cfg) {
+			s.logger.Debug("publisher %s is unchanged", name)
+			c.publishers[name] = existing
+			continue
 		}
-	}
-
-	s.publishers = map[string]publisher.Publisher{}
 
-	// set up new publishers
-	for name, cfg := range s.config.Publishers {
 		newFunc, ok := publisher.Providers[cfg.Type]
 		if !ok {
 			return fmt.Errorf("invalid publisher provider type %s", cfg.Type)
@@ -40,7 +35,7 @@ func (s *Service) LoadPublishers(ctx context.Context) error {
 		}
 
 		s.logger.Info("registering publisher %s", name)
-		s.publishers[name] = pub
+		c.publishers[name] = pub
 	}
 
 	return nil
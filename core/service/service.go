@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	gosync "sync"
 
 	"github.com/bhoriuchi/opa-bundle-server/core/bundle"
@@ -21,15 +22,9 @@ import (
 // Service implements service
 type Service struct {
 	mx            gosync.Mutex
+	rw            gosync.RWMutex
 	serviceConfig *Config
-	config        *config.Config
-	lock          lock.Lock
-	stores        map[string]store.Store
-	bundles       map[string]*bundle.Bundle
-	webhooks      map[string]webhook.Webhook
-	subscribers   map[string]subscriber.Subscriber
-	publishers    map[string]publisher.Publisher
-	deployers     map[string]deployer.Deployer
+	components    *components
 	logger        logger.Logger
 }
 
@@ -40,6 +35,30 @@ type Config struct {
 	LogFormat string
 }
 
+// components are the plugins and bundles created from a configuration
+type components struct {
+	config      *config.Config
+	lock        lock.Lock
+	stores      map[string]store.Store
+	bundles     map[string]*bundle.Bundle
+	webhooks    map[string]webhook.Webhook
+	subscribers map[string]subscriber.Subscriber
+	publishers  map[string]publisher.Publisher
+	deployers   map[string]deployer.Deployer
+}
+
+func newComponents(cfg *config.Config) *components {
+	return &components{
+		config:      cfg,
+		stores:      map[string]store.Store{},
+		bundles:     map[string]*bundle.Bundle{},
+		webhooks:    map[string]webhook.Webhook{},
+		subscribers: map[string]subscriber.Subscriber{},
+		publishers:  map[string]publisher.Publisher{},
+		deployers:   map[string]deployer.Deployer{},
+	}
+}
+
 // NewService creates a new service
 func NewService(serviceConfig *Config) (*Service, error) {
 	log := logging.New()
@@ -48,12 +67,7 @@ func NewService(serviceConfig *Config) (*Service, error) {
 
 	s := &Service{
 		serviceConfig: serviceConfig,
-		stores:        map[string]store.Store{},
-		bundles:       map[string]*bundle.Bundle{},
-		webhooks:      map[string]webhook.Webhook{},
-		subscribers:   map[string]subscriber.Subscriber{},
-		publishers:    map[string]publisher.Publisher{},
-		deployers:     map[string]deployer.Deployer{},
+		components:    newComponents(&config.Config{}),
 		logger:        log,
 	}
 
@@ -62,7 +76,13 @@ func NewService(serviceConfig *Config) (*Service, error) {
 		return nil, err
 	}
 
-	// TODO: handle file watching
+	// reload the configuration on SIGHUP and optionally when the file changes
+	s.HandleSignals(context.TODO())
+	if serviceConfig.Watch {
+		if err := s.Watch(context.TODO()); err != nil {
+			return nil, err
+		}
+	}
 
 	return s, nil
 }
@@ -72,10 +92,21 @@ func (s *Service) Logger() logger.Logger {
 }
 
 func (s *Service) Config() *config.Config {
-	return s.config
+	return s.current().config
 }
 
-// RelodConfig reloads the configuration file
+// current returns the components that are currently in use
+func (s *Service) current() *components {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.components
+}
+
+// RelodConfig reloads the configuration file. The new configuration is
+// fully loaded and connected before any of the current components are
+// torn down. If loading fails the current configuration remains in use.
+// Components whose configuration has not changed are reused so that
+// locks, connections, and built bundles are kept across reloads
 func (s *Service) ReloadConfig(ctx context.Context) error {
 	s.mx.Lock()
 	defer s.mx.Unlock()
@@ -90,55 +121,157 @@ func (s *Service) ReloadConfig(ctx context.Context) error {
 		return fmt.Errorf("failed to parse configuration file %s: %s", s.serviceConfig.File, err)
 	}
 
-	s.config = cfg
+	prev := s.current()
+	next := newComponents(cfg)
+	if err := s.load(ctx, next, prev); err != nil {
+		s.disconnect(ctx, next, prev)
+		return err
+	}
 
-	if err := s.Lock(ctx); err != nil {
+	s.rw.Lock()
+	s.components = next
+	s.rw.Unlock()
+
+	// tear down the previous components before activating
+	// the new ones so that only one set is running
+	for name, b := range prev.bundles {
+		if next.bundles[name] == b {
+			continue
+		}
+		if err := b.Deactivate(); err != nil {
+			s.logger.Error("failed to deactivate bundle %s: %s", name, err)
+		}
+	}
+	s.disconnect(ctx, prev, next)
+
+	for name, b := range next.bundles {
+		if prev.bundles[name] == b {
+			continue
+		}
+		if err := b.Activate(); err != nil {
+			s.logger.Error("failed to activate bundle %s: %s", name, err)
+		}
+	}
+
+	if next.lock != prev.lock {
+		s.AcquireLock(next.lock)
+	}
+
+	return nil
+}
+
+// load creates and connects all of the components in the configuration.
+// Components from prev with the same name and configuration are reused
+func (s *Service) load(ctx context.Context, c, prev *components) error {
+	if err := s.LoadLock(ctx, c, prev); err != nil {
 		return err
 	}
 
-	if err := s.LoadStores(ctx); err != nil {
+	if err := s.LoadStores(ctx, c, prev); err != nil {
 		return err
 	}
 
-	if err := s.LoadSubscribers(ctx); err != nil {
+	if err := s.LoadSubscribers(ctx, c, prev); err != nil {
 		return err
 	}
 
-	if err := s.LoadPublishers(ctx); err != nil {
+	if err := s.LoadPublishers(ctx, c, prev); err != nil {
 		return err
 	}
 
-	if err := s.LoadDeployers(ctx); err != nil {
+	if err := s.LoadDeployers(ctx, c, prev); err != nil {
 		return err
 	}
 
-	if err := s.LoadWebhooks(ctx); err != nil {
+	if err := s.LoadWebhooks(ctx, c, prev); err != nil {
 		return err
 	}
 
-	if err := s.LoadBundles(ctx); err != nil {
+	if err := s.LoadBundles(ctx, c, prev); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// disconnect disconnects all of the connected components that are not
+// also in use by keep
+func (s *Service) disconnect(ctx context.Context, c, keep *components) {
+	for name, sub := range c.subscribers {
+		if keep.subscribers[name] == sub {
+			continue
+		}
+		if err := sub.Disconnect(ctx); err != nil {
+			s.logger.Error("Failed to disconnect subscriber %s: %s", name, err)
+		}
+	}
+
+	for name, pub := range c.publishers {
+		if keep.publishers[name] == pub {
+			continue
+		}
+		if err := pub.Disconnect(ctx); err != nil {
+			s.logger.Error("Failed to disconnect publisher %s: %s", name, err)
+		}
+	}
+
+	for name, st := range c.stores {
+		if keep.stores[name] == st {
+			continue
+		}
+		if err := st.Disconnect(ctx); err != nil {
+			s.logger.Error("Failed to disconnect from store %s: %s", name, err)
+		}
+	}
+
+	if c.lock != keep.lock {
+		if err := s.ReleaseLock(ctx, c.lock); err != nil {
+			s.logger.Error("Failed to release lock: %s", err)
+		}
+	}
+}
+
+// unchanged returns true if both plugin configurations are equal
+func unchanged(prev, next interface{}) bool {
+	return reflect.DeepEqual(prev, next)
+}
+
+// HandleCallback returns a callback that rebuilds every bundle matched by
+// the matcher. Matching bundles are rebuilt concurrently
 func (s *Service) HandleCallback(name, typ string, matcher func(b *bundle.Bundle) bool) func() {
 	return func() {
-		if len(s.bundles) == 0 {
+		bundles := s.Bundles()
+		if len(bundles) == 0 {
 			s.logger.Warn("no bundles were registered on the service")
 			return
 		}
-		for bundleName, bundle := range s.bundles {
+
+		var wg gosync.WaitGroup
+		matched := 0
+
+		for bundleName, b := range bundles {
 			s.logger.Debug("attempting to match bundle %s", bundleName)
-			if matcher(bundle) {
-				s.logger.Debug("%s callback handler %s matched bundle %s", typ, name, bundleName)
-				if err := bundle.Rebuild(context.TODO()); err != nil {
-					s.logger.Error("failed to rebuild bundle %s: %s", bundleName, err)
-				}
-				return
+			if !matcher(b) {
+				continue
 			}
+
+			s.logger.Debug("%s callback handler %s matched bundle %s", typ, name, bundleName)
+			matched++
+			wg.Add(1)
+
+			go func(bundleName string, b *bundle.Bundle) {
+				defer wg.Done()
+				if err := b.Rebuild(context.TODO()); err != nil {
+					s.logger.Error("%s callback handler %s failed to rebuild bundle %s: %s", typ, name, bundleName, err)
+				}
+			}(bundleName, b)
+		}
+
+		if matched == 0 {
+			s.logger.Warn("%s callback handler %s did not match any bundles", typ, name)
+			return
 		}
-		s.logger.Warn("%s callback handler %s did not match and plugins", typ, name)
+
+		wg.Wait()
 	}
 }
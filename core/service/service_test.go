@@ -0,0 +1,710 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/bundle"
+	"github.com/bhoriuchi/opa-bundle-server/core/service"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// harnesses are the harnesses of the running tests by name. The test
+// providers are registered once and look up the harness named in their
+// configuration so that every test keeps its own state
+var harnesses sync.Map
+
+func init() {
+	store.Providers["test"] = func(opts *store.Options) (store.Store, error) {
+		h, cfg, err := lookup(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		st := &testStore{h: h, config: cfg}
+		h.mx.Lock()
+		h.stores[opts.Name] = append(h.stores[opts.Name], st)
+		h.mx.Unlock()
+		return st, nil
+	}
+
+	subscriber.Providers["test"] = func(opts *subscriber.Options) (subscriber.Subscriber, error) {
+		h, cfg, err := lookup(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		sub := &testSubscriber{h: h, config: cfg, callback: opts.Callback}
+		h.mx.Lock()
+		h.subscribers[opts.Name] = append(h.subscribers[opts.Name], sub)
+		h.mx.Unlock()
+		return sub, nil
+	}
+
+	lock.Providers["test"] = func(opts *lock.Options) (lock.Lock, error) {
+		h, cfg, err := lookup(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		l := &testLock{h: h, config: cfg, closed: make(chan struct{})}
+		h.mx.Lock()
+		h.locks = append(h.locks, l)
+		h.mx.Unlock()
+		return l, nil
+	}
+}
+
+// testConfig is the configuration of the test providers
+type testConfig struct {
+	Harness string `json:"harness"`
+	Policy  string `json:"policy"`
+	Fail    bool   `json:"fail"`
+	Block   bool   `json:"block"`
+}
+
+// harness records the plugins created by the service of a test
+type harness struct {
+	mx          sync.Mutex
+	file        string
+	stores      map[string][]*testStore
+	subscribers map[string][]*testSubscriber
+	locks       []*testLock
+	logs        []string
+
+	// unblock releases the builds of blocking stores
+	unblock chan struct{}
+
+	// unlocking receives when a blocking lock starts unlocking
+	// and release unblocks the unlock
+	unlocking chan struct{}
+	release   chan struct{}
+}
+
+func newHarness(t *testing.T) *harness {
+	h := &harness{
+		file:        filepath.Join(t.TempDir(), "config.yaml"),
+		stores:      map[string][]*testStore{},
+		subscribers: map[string][]*testSubscriber{},
+		unblock:     make(chan struct{}),
+		unlocking:   make(chan struct{}, 1),
+		release:     make(chan struct{}),
+	}
+
+	harnesses.Store(t.Name(), h)
+	t.Cleanup(func() { harnesses.Delete(t.Name()) })
+	return h
+}
+
+func lookup(config interface{}) (*harness, *testConfig, error) {
+	cfg := &testConfig{}
+	if err := utils.ReMarshal(config, cfg); err != nil {
+		return nil, nil, err
+	}
+
+	h, ok := harnesses.Load(cfg.Harness)
+	if !ok {
+		return nil, nil, fmt.Errorf("harness %s not found", cfg.Harness)
+	}
+
+	return h.(*harness), cfg, nil
+}
+
+// writeConfig writes the configuration file. %[1]s in the configuration
+// is replaced with the name of the harness
+func (h *harness) writeConfig(t *testing.T, config string) {
+	content := []byte(fmt.Sprintf(config, t.Name()))
+	if err := ioutil.WriteFile(h.file, content, 0644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+}
+
+// newService creates a service from the configuration and records its logs
+func (h *harness) newService(t *testing.T, config string) *service.Service {
+	h.writeConfig(t, config)
+
+	s, err := service.NewService(&service.Config{
+		File:     h.file,
+		LogLevel: "warn",
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+
+	s.Logger().(*logging.StandardLogger).SetFormatter(h)
+	return s
+}
+
+// Format implements logrus.Formatter to record the logged messages
+func (h *harness) Format(entry *logrus.Entry) ([]byte, error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.logs = append(h.logs, entry.Message)
+	return nil, nil
+}
+
+func (h *harness) logged(msg string) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	for _, log := range h.logs {
+		if strings.Contains(log, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// store returns the instances of a store in the order they were created
+func (h *harness) store(name string) []*testStore {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return append([]*testStore{}, h.stores[name]...)
+}
+
+func (h *harness) subscriber(name string) []*testSubscriber {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return append([]*testSubscriber{}, h.subscribers[name]...)
+}
+
+func (h *harness) lockCount() int {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return len(h.locks)
+}
+
+// testStore builds a bundle from the policy in its configuration
+type testStore struct {
+	h            *harness
+	config       *testConfig
+	builds       int
+	disconnected bool
+}
+
+func (s *testStore) Connect(ctx context.Context) error {
+	if s.config.Fail {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func (s *testStore) Disconnect(ctx context.Context) error {
+	s.h.mx.Lock()
+	defer s.h.mx.Unlock()
+	s.disconnected = true
+	return nil
+}
+
+func (s *testStore) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	if s.config.Block {
+		select {
+		case <-s.h.unblock:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.h.mx.Lock()
+	s.builds++
+	s.h.mx.Unlock()
+
+	return store.Archive(ctx, store.EntryList{
+		{Key: "policy.rego", Value: []byte(s.config.Policy)},
+	})
+}
+
+func (s *testStore) buildCount() int {
+	s.h.mx.Lock()
+	defer s.h.mx.Unlock()
+	return s.builds
+}
+
+func (s *testStore) isDisconnected() bool {
+	s.h.mx.Lock()
+	defer s.h.mx.Unlock()
+	return s.disconnected
+}
+
+type testSubscriber struct {
+	h            *harness
+	config       *testConfig
+	callback     func()
+	disconnected bool
+}
+
+func (s *testSubscriber) Connect(ctx context.Context) error {
+	if s.config.Fail {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func (s *testSubscriber) Disconnect(ctx context.Context) error {
+	s.h.mx.Lock()
+	defer s.h.mx.Unlock()
+	s.disconnected = true
+	return nil
+}
+
+func (s *testSubscriber) Subscribe(ctx context.Context) error   { return nil }
+func (s *testSubscriber) Unsubscribe(ctx context.Context) error { return nil }
+
+func (s *testSubscriber) isDisconnected() bool {
+	s.h.mx.Lock()
+	defer s.h.mx.Unlock()
+	return s.disconnected
+}
+
+// testLock is always held. A blocking lock blocks when unlocking
+// until it is released by the harness
+type testLock struct {
+	h      *harness
+	config *testConfig
+	closed chan struct{}
+}
+
+func (l *testLock) Connect(ctx context.Context) error    { return nil }
+func (l *testLock) Disconnect(ctx context.Context) error { return nil }
+func (l *testLock) HasLock() bool                        { return true }
+
+func (l *testLock) Lock(ctx context.Context) error {
+	<-l.closed
+	return lock.ErrLockClosed
+}
+
+func (l *testLock) Unlock(ctx context.Context) error {
+	if l.config.Block {
+		l.h.unlocking <- struct{}{}
+		<-l.h.release
+	}
+	close(l.closed)
+	return nil
+}
+
+// waitFor waits for the condition to be true
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// idle waits for the initial build of an activated bundle to finish.
+// Rebuilds requested during a build are dropped, so the bundle is idle
+// once a rebuild requested after the initial build started has built it
+func idle(t *testing.T, b *bundle.Bundle, st *testStore) {
+	t.Helper()
+
+	waitFor(t, fmt.Sprintf("expected bundle %s to be built", b.Name), func() bool {
+		return st.buildCount() > 0
+	})
+
+	waitFor(t, fmt.Sprintf("expected bundle %s to be rebuilt", b.Name), func() bool {
+		before := st.buildCount()
+		if err := b.Rebuild(context.Background()); err != nil {
+			t.Fatalf("failed to rebuild bundle %s: %s", b.Name, err)
+		}
+		return st.buildCount() > before
+	})
+}
+
+const callbackConfig = `
+stores:
+  a:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package a
+  b:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package b
+  c:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package c
+subscribers:
+  events:
+    type: test
+    config:
+      harness: %[1]s
+  other:
+    type: test
+    config:
+      harness: %[1]s
+bundles:
+  a:
+    store: a
+    subscribers:
+      - events
+    polling:
+      disable: true
+  b:
+    store: b
+    subscribers:
+      - events
+    polling:
+      disable: true
+  c:
+    store: c
+    polling:
+      disable: true
+`
+
+// TestCallbackRebuildsLinkedBundles checks that a single callback rebuilds
+// every bundle linked to the subscriber and that a callback that does not
+// match any bundle rebuilds nothing
+func TestCallbackRebuildsLinkedBundles(t *testing.T) {
+	t.Parallel()
+
+	h := newHarness(t)
+	s := h.newService(t, callbackConfig)
+
+	stores := map[string]*testStore{}
+	for _, name := range []string{"a", "b", "c"} {
+		stores[name] = h.store(name)[0]
+		idle(t, s.Bundles()[name], stores[name])
+	}
+
+	builds := func() map[string]int {
+		counts := map[string]int{}
+		for name, st := range stores {
+			counts[name] = st.buildCount()
+		}
+		return counts
+	}
+
+	before := builds()
+	h.subscriber("events")[0].callback()
+	after := builds()
+
+	for name, expected := range map[string]int{"a": 1, "b": 1, "c": 0} {
+		if rebuilt := after[name] - before[name]; rebuilt != expected {
+			t.Errorf("expected bundle %s to be rebuilt %d time(s), got %d", name, expected, rebuilt)
+		}
+	}
+
+	before = after
+	h.subscriber("other")[0].callback()
+	after = builds()
+
+	for name := range stores {
+		if after[name] != before[name] {
+			t.Errorf("expected bundle %s to not be rebuilt by an unmatched callback", name)
+		}
+	}
+
+	if !h.logged("subscriber callback handler other did not match any bundles") {
+		t.Error("expected the unmatched callback to be logged")
+	}
+}
+
+const reloadConfig = `
+lock:
+  type: test
+  config:
+    harness: %[1]s
+stores:
+  a:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package a
+  b:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package b
+subscribers:
+  events:
+    type: test
+    config:
+      harness: %[1]s
+  extra:
+    type: test
+    config:
+      harness: %[1]s
+bundles:
+  a:
+    store: a
+    subscribers:
+      - events
+    polling:
+      disable: true
+  b:
+    store: b
+    subscribers:
+      - events
+    polling:
+      disable: true
+`
+
+// reloadChangedConfig changes store b so that its builds block and
+// removes the extra subscriber
+const reloadChangedConfig = `
+lock:
+  type: test
+  config:
+    harness: %[1]s
+stores:
+  a:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package a
+  b:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package b.changed
+      block: true
+subscribers:
+  events:
+    type: test
+    config:
+      harness: %[1]s
+bundles:
+  a:
+    store: a
+    subscribers:
+      - events
+    polling:
+      disable: true
+  b:
+    store: b
+    subscribers:
+      - events
+    polling:
+      disable: true
+`
+
+// TestReloadChangedStore checks that a reload only recreates the changed
+// store and its bundle, that the recreated bundle serves the previously
+// built bundle until it is rebuilt, and that removed plugins are disconnected
+func TestReloadChangedStore(t *testing.T) {
+	t.Parallel()
+
+	h := newHarness(t)
+	s := h.newService(t, reloadConfig)
+
+	prevA, prevB := s.Bundles()["a"], s.Bundles()["b"]
+	storeA, storeB := h.store("a")[0], h.store("b")[0]
+	idle(t, prevA, storeA)
+	idle(t, prevB, storeB)
+	etag := prevB.Etag()
+
+	h.writeConfig(t, reloadChangedConfig)
+	if err := s.ReloadConfig(context.Background()); err != nil {
+		t.Fatalf("failed to reload config: %s", err)
+	}
+
+	if h.lockCount() != 1 {
+		t.Errorf("expected the unchanged lock to be reused, got %d locks", h.lockCount())
+	}
+
+	if stores := h.store("a"); len(stores) != 1 || s.Bundles()["a"].Store != storeA || storeA.isDisconnected() {
+		t.Errorf("expected the unchanged store to be reused")
+	}
+
+	if s.Bundles()["a"] != prevA {
+		t.Errorf("expected the unchanged bundle to be reused")
+	}
+
+	if events := h.subscriber("events"); len(events) != 1 || events[0].isDisconnected() {
+		t.Errorf("expected the unchanged subscriber to be reused")
+	}
+
+	if !h.subscriber("extra")[0].isDisconnected() {
+		t.Errorf("expected the removed subscriber to be disconnected")
+	}
+
+	if !storeB.isDisconnected() {
+		t.Errorf("expected the changed store to be disconnected")
+	}
+
+	b := s.Bundles()["b"]
+	if b == prevB || b.Store == storeB {
+		t.Fatal("expected the bundle of the changed store to be recreated")
+	}
+
+	// the build of the new store is blocked so the inherited bundle is served
+	if b.Etag() != etag {
+		t.Errorf("expected the recreated bundle to serve the inherited bundle")
+	}
+
+	close(h.unblock)
+	waitFor(t, "expected the recreated bundle to be rebuilt", func() bool {
+		return b.Etag() != etag && b.Etag() != ""
+	})
+}
+
+const failedReloadConfig = `
+stores:
+  a:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package a
+  c:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package c
+subscribers:
+  broken:
+    type: test
+    config:
+      harness: %[1]s
+      fail: true
+bundles:
+  a:
+    store: a
+    subscribers:
+      - broken
+    polling:
+      disable: true
+  c:
+    store: c
+    polling:
+      disable: true
+`
+
+// TestFailedReloadKeepsServing checks that an invalid configuration or a
+// plugin that fails to connect leaves the current components serving
+func TestFailedReloadKeepsServing(t *testing.T) {
+	t.Parallel()
+
+	h := newHarness(t)
+	s := h.newService(t, `
+stores:
+  a:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package a
+bundles:
+  a:
+    store: a
+    polling:
+      disable: true
+`)
+
+	b, st := s.Bundles()["a"], h.store("a")[0]
+	idle(t, b, st)
+	etag := b.Etag()
+
+	serving := func() {
+		t.Helper()
+
+		if s.Bundles()["a"] != b || len(s.Bundles()) != 1 {
+			t.Errorf("expected the current bundles to remain in use")
+		}
+
+		if st.isDisconnected() {
+			t.Errorf("expected the current store to remain connected")
+		}
+
+		w := httptest.NewRecorder()
+		s.HandleBundle("a", w, httptest.NewRequest(http.MethodGet, "/bundles/a", nil))
+		if w.Code != http.StatusOK || w.Header().Get("ETag") != etag {
+			t.Errorf("expected the bundle to be served, got status %d and etag %q", w.Code, w.Header().Get("ETag"))
+		}
+	}
+
+	h.writeConfig(t, "stores: [")
+	if err := s.ReloadConfig(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("expected an invalid configuration error, got %v", err)
+	}
+	serving()
+
+	h.writeConfig(t, failedReloadConfig)
+	if err := s.ReloadConfig(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to connect test subscriber broken") {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+	serving()
+
+	if stores := h.store("c"); len(stores) != 1 || !stores[0].isDisconnected() {
+		t.Errorf("expected the store loaded by the failed reload to be disconnected")
+	}
+}
+
+const lockReloadConfig = `
+lock:
+  type: test
+  config:
+    harness: %[1]s
+    block: true
+    key: %[2]s
+stores:
+  a:
+    type: test
+    config:
+      harness: %[1]s
+      policy: package a
+subscribers:
+  events:
+    type: test
+    config:
+      harness: %[1]s
+bundles:
+  a:
+    store: a
+    subscribers:
+      - events
+    polling:
+      disable: true
+      min_delay_seconds: %[3]d
+`
+
+// TestCallbackDuringReload sends a subscriber callback while the previous
+// components are being torn down and the new bundle is not yet activated
+func TestCallbackDuringReload(t *testing.T) {
+	t.Parallel()
+
+	h := newHarness(t)
+	s := h.newService(t, fmt.Sprintf(lockReloadConfig, "%[1]s", "first", 1))
+
+	// change the lock and the bundle so that both are recreated
+	h.writeConfig(t, fmt.Sprintf(lockReloadConfig, "%[1]s", "second", 2))
+
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- s.ReloadConfig(context.Background()) }()
+
+	select {
+	case <-h.unlocking:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the previous lock to be released")
+	}
+
+	h.subscriber("events")[0].callback()
+
+	close(h.release)
+	if err := <-reloaded; err != nil {
+		t.Fatalf("failed to reload config: %s", err)
+	}
+
+	if s.Bundles()["a"].Artifact() == nil {
+		t.Error("expected the bundle to be built by the callback")
+	}
+}
@@ -4,22 +4,22 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bhoriuchi/opa-bundle-server/core/bundle"
 	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
 )
 
 // LoadStores loads and connects to stores
-func (s *Service) LoadStores(ctx context.Context) error {
-	if s.stores != nil {
-		for name, store := range s.stores {
-			if err := store.Disconnect(context.Background()); err != nil {
-				s.logger.Error("Failed to disconnect from store %s: %s", name, err)
-			}
+func (s *Service) LoadStores(ctx context.Context, c, prev *components) error {
+	for name, cfg := range c.config.Stores {
+		// the callback matcher is called after the loop so it needs its own copy
+		name := name
+
+		if existing, ok := prev.stores[name]; ok && unchanged(prev.config.Stores[name], cfg) {
+			s.logger.Debug("store %s is unchanged", name)
+			c.stores[name] = existing
+			continue
 		}
-	}
-
-	s.stores = map[string]store.Store{}
 
-	for name, cfg := range s.config.Stores {
 		newFunc, ok := store.Providers[cfg.Type]
 		if !ok {
 			return fmt.Errorf("invalid store provider type %s", cfg.Type)
@@ -29,16 +29,19 @@ func (s *Service) LoadStores(ctx context.Context) error {
 			Name:   name,
 			Config: cfg.Config,
 			Logger: s.logger,
+			Callback: s.HandleCallback(name, "store", func(b *bundle.Bundle) bool {
+				return b.Config.Store == name
+			}),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to initialize %s store %s: %s", cfg.Type, name, err)
 		}
 
 		if err := st.Connect(ctx); err != nil {
-			return err
+			return fmt.Errorf("failed to connect %s store %s: %s", cfg.Type, name, err)
 		}
 
-		s.stores[name] = st
+		c.stores[name] = st
 	}
 
 	return nil
@@ -10,19 +10,18 @@ import (
 )
 
 // LoadSubscribers loads and connects subscribers
-func (s *Service) LoadSubscribers(ctx context.Context) error {
-	if s.subscribers != nil {
-		for name, sub := range s.subscribers {
-			if err := sub.Disconnect(context.Background()); err != nil {
-				s.logger.Error("Failed to disconnect subscriber %s: %s", name, err)
-			}
+func (s *Service) LoadSubscribers(ctx context.Context, c, prev *components) error {
+	// set up new subscribers
+	for name, cfg := range c.config.Subscribers {
+		// the callback matcher is called after the loop so it needs its own copy
+		name := name
+
+		if existing, ok := prev.subscribers[name]; ok && unchanged(prev.config.Subscribers[name], cfg) {
+			s.logger.Debug("subscriber %s is unchanged", name)
+			c.subscribers[name] = existing
+			continue
 		}
-	}
-
-	s.subscribers = map[string]subscriber.Subscriber{}
 
-	// set up new subscribers
-	for name, cfg := range s.config.Subscribers {
 		newFunc, ok := subscriber.Providers[cfg.Type]
 		if !ok {
 			return fmt.Errorf("invalid subscriber provider type %s", cfg.Type)
@@ -44,12 +43,13 @@ func (s *Service) LoadSubscribers(ctx context.Context) error {
 			return fmt.Errorf("failed to connect %s subscriber %s: %s", cfg.Type, name, err)
 		}
 
+		c.subscribers[name] = sub
+
 		if err := sub.Subscribe(ctx); err != nil {
 			return fmt.Errorf("failed to subscribe %s subscriber %s: %s", cfg.Type, name, err)
 		}
 
 		s.logger.Info("registering subscriber %s", name)
-		s.subscribers[name] = sub
 	}
 
 	return nil
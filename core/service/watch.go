@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/bep/debounce"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchDebounce = 500 * time.Millisecond
+)
+
+// HandleSignals reloads the configuration when the process receives SIGHUP
+func (s *Service) HandleSignals(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				s.logger.Info("received SIGHUP, reloading configuration file %s", s.serviceConfig.File)
+				s.reload(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Watch reloads the configuration when the configuration file changes. The
+// parent directory is watched so that files replaced by editors or updated
+// through symlinks (kubernetes config maps) are detected
+func (s *Service) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create configuration file watcher: %s", err)
+	}
+
+	file := filepath.Clean(s.serviceConfig.File)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch configuration file %s: %s", file, err)
+	}
+
+	// resolve symlinks so that changes to the link target are detected
+	target, _ := filepath.EvalSymlinks(file)
+	debounced := debounce.New(watchDebounce)
+
+	go func() {
+		defer watcher.Close()
+		s.logger.Info("watching configuration file %s for changes", file)
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// ignore events for other files in the directory unless
+				// the configuration file now points to a new target
+				current, _ := filepath.EvalSymlinks(file)
+				if filepath.Clean(event.Name) != file && current == target {
+					continue
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				target = current
+				s.logger.Debug("configuration file watcher received event %s", event)
+				debounced(func() {
+					s.logger.Info("configuration file %s changed, reloading", file)
+					s.reload(ctx)
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				s.logger.Error("configuration file watcher error: %s", err)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload reloads the configuration and logs the result
+func (s *Service) reload(ctx context.Context) {
+	if err := s.ReloadConfig(ctx); err != nil {
+		s.logger.Error("failed to reload configuration, keeping the current configuration: %s", err)
+		return
+	}
+
+	s.logger.Info("reloaded configuration file %s", s.serviceConfig.File)
+}
@@ -12,7 +12,7 @@ import (
 
 // HandleWebhook handles webhooks
 func (s *Service) HandleWebhook(name string, w http.ResponseWriter, r *http.Request) {
-	hook, ok := s.webhooks[name]
+	hook, ok := s.current().webhooks[name]
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -22,11 +22,18 @@ func (s *Service) HandleWebhook(name string, w http.ResponseWriter, r *http.Requ
 }
 
 // LoadWebhooks loads webhooks
-func (s *Service) LoadWebhooks(ctx context.Context) error {
-	s.webhooks = map[string]webhook.Webhook{}
-
+func (s *Service) LoadWebhooks(ctx context.Context, c, prev *components) error {
 	// set up new webhooks
-	for name, cfg := range s.config.Webhooks {
+	for name, cfg := range c.config.Webhooks {
+		// the callback matcher is called after the loop so it needs its own copy
+		name := name
+
+		if existing, ok := prev.webhooks[name]; ok && unchanged(prev.config.Webhooks[name], cfg) {
+			s.logger.Debug("webhook %s is unchanged", name)
+			c.webhooks[name] = existing
+			continue
+		}
+
 		newFunc, ok := webhook.Providers[cfg.Type]
 		if !ok {
 			return fmt.Errorf("invalid webhook provider type %s", cfg.Type)
@@ -44,7 +51,7 @@ func (s *Service) LoadWebhooks(ctx context.Context) error {
 			return fmt.Errorf("failed to initialize %s webhook %s: %s", cfg.Type, name, err)
 		}
 
-		s.webhooks[name] = hook
+		c.webhooks[name] = hook
 	}
 	return nil
 }
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig is the tls configuration shared by clients. Certificates
+// and keys can be provided as files or pem encoded strings
+type TLSConfig struct {
+	CAFile             string `json:"ca_file" yaml:"ca_file"`
+	CAPEM              string `json:"ca_pem" yaml:"ca_pem"`
+	CertFile           string `json:"cert_file" yaml:"cert_file"`
+	CertPEM            string `json:"cert_pem" yaml:"cert_pem"`
+	KeyFile            string `json:"key_file" yaml:"key_file"`
+	KeyPEM             string `json:"key_pem" yaml:"key_pem"`
+	ServerName         string `json:"server_name" yaml:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// Load creates a tls config. A nil config returns a nil tls config
+func (c *TLSConfig) Load() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	ca := []byte(c.CAPEM)
+	if c.CAFile != "" {
+		content, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %s", err)
+		}
+		ca = content
+	}
+
+	if len(ca) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse ca certificates")
+		}
+	}
+
+	cert, key := []byte(c.CertPEM), []byte(c.KeyPEM)
+	if c.CertFile != "" {
+		content, err := ioutil.ReadFile(c.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cert file: %s", err)
+		}
+		cert = content
+	}
+
+	if c.KeyFile != "" {
+		content, err := ioutil.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %s", err)
+		}
+		key = content
+	}
+
+	if len(cert) > 0 || len(key) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
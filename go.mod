@@ -3,16 +3,26 @@ module github.com/bhoriuchi/opa-bundle-server
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.16.0
 	github.com/bep/debounce v1.2.0
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-chi/chi/v5 v5.0.4
+	github.com/go-git/go-git/v5 v5.4.2
 	github.com/go-playground/webhooks/v6 v6.0.0-beta.3
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/google/uuid v1.3.0
 	github.com/hashicorp/consul/api v1.11.0
-	github.com/hashicorp/go-getter/v2 v2.0.0
-	github.com/hashicorp/go-hclog v0.12.0
+	github.com/lib/pq v1.10.3
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/nats-io/nats-server/v2 v2.6.2
+	github.com/nats-io/nats.go v1.13.0
 	github.com/oleiade/lane v1.0.1
 	github.com/open-policy-agent/opa v0.33.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.2.1
+	github.com/xeipuuv/gojsonschema v1.2.0
+	go.etcd.io/etcd/client/v3 v3.5.1
+	go.etcd.io/etcd/server/v3 v3.5.1
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
 )
@@ -18,6 +18,14 @@ type Options struct {
 	Logger logger.Logger
 }
 
+// Bundle is a built bundle to deploy
+type Bundle struct {
+	Name     string
+	Revision string
+	Etag     string
+	Data     []byte
+}
+
 type Deployer interface {
-	Deploy(ctx context.Context) (err error)
+	Deploy(ctx context.Context, bundle *Bundle) (err error)
 }
@@ -0,0 +1,82 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/deployer"
+)
+
+const (
+	ProviderName = "directory"
+)
+
+func init() {
+	deployer.Providers[ProviderName] = NewDeployer
+}
+
+type Deployer struct {
+	name   string
+	config *Config
+	logger logger.Logger
+}
+
+type Config struct {
+	Directory string `json:"directory" yaml:"directory"`
+}
+
+// NewDeployer creates a new deployer
+func NewDeployer(opts *deployer.Options) (deployer.Deployer, error) {
+	d := &Deployer{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for deployer %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, d.config); err != nil {
+		return nil, err
+	}
+
+	if d.config.Directory == "" {
+		return nil, fmt.Errorf("no directory specified for directory deployer %s", opts.Name)
+	}
+
+	return d, nil
+}
+
+// Deploy writes the bundle archive and its etag to the directory. Each
+// file is written to a temp file and renamed so that readers never see
+// a partially written bundle
+func (d *Deployer) Deploy(ctx context.Context, bundle *deployer.Bundle) (err error) {
+	if bundle.Name == "" || strings.ContainsAny(bundle.Name, `/\`) {
+		return fmt.Errorf("directory deployer %s cannot write bundle with name %q", d.name, bundle.Name)
+	}
+
+	dir, err := filepath.Abs(d.config.Directory)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	file := filepath.Join(dir, bundle.Name+".tar.gz")
+	d.logger.Debug("directory deployer %s writing bundle %s to %s", d.name, bundle.Name, file)
+	if err = utils.WriteFileAtomic(file, bundle.Data, 0644); err != nil {
+		return
+	}
+
+	// write the etag last so that it never references a bundle that
+	// has not been written yet
+	return utils.WriteFileAtomic(file+".etag", []byte(bundle.Etag), 0644)
+}
@@ -0,0 +1,92 @@
+package directory_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/deployer"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/deployer/directory"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func newDeployer(t *testing.T, dir string) deployer.Deployer {
+	d, err := directory.NewDeployer(&deployer.Options{
+		Name:   "test",
+		Config: directory.Config{Directory: dir},
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create directory deployer: %s", err)
+	}
+	return d
+}
+
+func readFile(t *testing.T, filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", filename, err)
+	}
+	return string(data)
+}
+
+func TestDeploy(t *testing.T) {
+	dir := t.TempDir()
+	d := newDeployer(t, dir)
+
+	for _, b := range []*deployer.Bundle{
+		{Name: "authz", Etag: "etag-1", Data: []byte("bundle-1")},
+		{Name: "authz", Etag: "etag-2", Data: []byte("bundle-2")},
+	} {
+		if err := d.Deploy(context.Background(), b); err != nil {
+			t.Fatalf("failed to deploy bundle: %s", err)
+		}
+
+		if data := readFile(t, filepath.Join(dir, "authz.tar.gz")); data != string(b.Data) {
+			t.Errorf("expected bundle %q, got %q", b.Data, data)
+		}
+
+		if etag := readFile(t, filepath.Join(dir, "authz.tar.gz.etag")); etag != b.Etag {
+			t.Errorf("expected etag %q, got %q", b.Etag, etag)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %s", err)
+	}
+
+	for _, file := range files {
+		if strings.Contains(file.Name(), ".tmp-") {
+			t.Errorf("expected temp file %s to be removed", file.Name())
+		}
+	}
+
+	if len(files) != 2 {
+		t.Errorf("expected 2 files, got %d", len(files))
+	}
+}
+
+func TestDeployInvalidName(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "bundles")
+	d := newDeployer(t, dir)
+
+	for _, name := range []string{"", "../authz", "authz/v1", `..\authz`} {
+		err := d.Deploy(context.Background(), &deployer.Bundle{Name: name, Etag: "etag", Data: []byte("bundle")})
+		if err == nil {
+			t.Errorf("expected bundle name %q to be rejected", name)
+		}
+	}
+
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatalf("failed to read directory: %s", err)
+	}
+
+	if len(files) != 0 {
+		t.Errorf("expected nothing to be written, got %d files", len(files))
+	}
+}
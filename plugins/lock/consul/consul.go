@@ -34,6 +34,7 @@ type Lock struct {
 	lock    *api.Lock
 	wait    time.Duration
 	ttl     string
+	cb      func(hasLock bool)
 }
 
 type Config struct {
@@ -48,6 +49,7 @@ func NewLock(opts *lock.Options) (lock.Lock, error) {
 		cc:     make(chan struct{}),
 		config: &Config{},
 		logger: opts.Logger,
+		cb:     opts.Callback,
 		wait:   api.DefaultLockWaitTime,
 		ttl:    api.DefaultLockSessionTTL,
 	}
@@ -114,6 +116,10 @@ func (l *Lock) setHasLock(hasLock bool) {
 	} else {
 		l.logger.Debug("node %s failed to acquire lock", l.id)
 	}
+
+	if l.cb != nil && prev != hasLock {
+		l.cb(hasLock)
+	}
 }
 
 // Lock creates a new lock
@@ -171,6 +177,11 @@ func (l *Lock) Unlock(ctx context.Context) (err error) {
 		go func() { l.cc <- struct{}{} }()
 	}
 
+	// the lock was never attempted
+	if l.lock == nil {
+		return
+	}
+
 	if err = l.lock.Unlock(); err != nil {
 		if err == api.ErrLockNotHeld {
 			err = nil
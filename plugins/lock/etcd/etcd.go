@@ -0,0 +1,241 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock"
+	"github.com/google/uuid"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const (
+	ProviderName  = "etcd"
+	DefaultKey    = "opa-bundle-server/lock"
+	DefaultTTL    = "15s"
+	retryDelay    = time.Second
+	resignTimeout = 5 * time.Second
+)
+
+func init() {
+	lock.Providers[ProviderName] = NewLock
+}
+
+type Lock struct {
+	id      string
+	mx      sync.Mutex
+	hasLock bool
+	closed  bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	client  *etcd.Client
+	config  *Config
+	logger  logger.Logger
+	ttl     int
+	cb      func(hasLock bool)
+}
+
+type Config struct {
+	Key  string       `json:"key" yaml:"key"`
+	TTL  string       `json:"ttl" yaml:"ttl"`
+	Etcd *etcd.Config `json:"etcd" yaml:"etcd"`
+}
+
+// NewLock creates a new lock manager
+func NewLock(opts *lock.Options) (lock.Lock, error) {
+	l := &Lock{
+		id:     uuid.NewString(),
+		config: &Config{},
+		logger: opts.Logger,
+		cb:     opts.Callback,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("node %s invalid configuration for etcd lock", l.id)
+	}
+
+	if err := utils.ReMarshal(opts.Config, l.config); err != nil {
+		return nil, err
+	}
+
+	if l.config.Etcd == nil {
+		return nil, fmt.Errorf("node %s no etcd configuration provided for etcd lock", l.id)
+	}
+
+	if l.config.Key == "" {
+		l.config.Key = DefaultKey
+	}
+
+	if l.config.TTL == "" {
+		l.config.TTL = DefaultTTL
+	}
+
+	ttl, err := time.ParseDuration(l.config.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("node %s invalid ttl for etcd lock: %s", l.id, err)
+	}
+
+	// lease ttls are in seconds
+	if l.ttl = int(ttl.Seconds()); l.ttl < 1 {
+		return nil, fmt.Errorf("node %s etcd lock ttl must be at least 1s", l.id)
+	}
+
+	return l, nil
+}
+
+// HasLock lock is held by this node
+func (l *Lock) HasLock() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.hasLock
+}
+
+// Connect connects to etcd
+func (l *Lock) Connect(ctx context.Context) (err error) {
+	l.logger.Debug("node %s connecting to etcd lock %v", l.id, l.config.Etcd.Endpoints)
+	if l.client != nil {
+		return fmt.Errorf("node %s already connected", l.id)
+	}
+
+	l.client, err = etcd.NewClient(l.config.Etcd)
+	return
+}
+
+// Disconnect disconnects from etcd
+func (l *Lock) Disconnect(ctx context.Context) (err error) {
+	if l.client == nil {
+		err = fmt.Errorf("node %s not connected", l.id)
+		return
+	}
+
+	err = l.client.Close()
+	l.client = nil
+	return
+}
+
+// setHasLock sets the has lock property
+func (l *Lock) setHasLock(hasLock bool) {
+	l.mx.Lock()
+	prev := l.hasLock
+	l.hasLock = hasLock
+	l.mx.Unlock()
+
+	if hasLock {
+		l.logger.Debug("node %s acquired lock", l.id)
+	} else if prev {
+		l.logger.Debug("node %s lock lost", l.id)
+	} else {
+		l.logger.Debug("node %s failed to acquire lock", l.id)
+	}
+
+	if l.cb != nil && prev != hasLock {
+		l.cb(hasLock)
+	}
+}
+
+// Lock campaigns for leadership of the election on the lock key. The
+// election is tied to a lease that is kept alive while the lock is held
+func (l *Lock) Lock(ctx context.Context) (err error) {
+	l.mx.Lock()
+	if l.closed {
+		l.mx.Unlock()
+		return lock.ErrLockClosed
+	}
+	lockCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	l.cancel, l.done = cancel, done
+	l.mx.Unlock()
+	defer close(done)
+	defer cancel()
+
+	// the session is not bound to the lock context so that
+	// its lease can still be revoked after unlocking
+	session, err := concurrency.NewSession(
+		l.client.Etcd(),
+		concurrency.WithTTL(l.ttl),
+		concurrency.WithContext(ctx),
+	)
+	if err != nil {
+		l.logger.Error("node %s failed to create etcd session: %s", l.id, err)
+		return l.failed(lockCtx)
+	}
+	defer session.Close()
+
+	election := concurrency.NewElection(session, l.config.Key)
+	if err = election.Campaign(lockCtx, l.id); err != nil {
+		return l.failed(lockCtx)
+	}
+
+	l.setHasLock(true)
+
+	select {
+	case <-lockCtx.Done():
+		resignCtx, cancelResign := context.WithTimeout(context.Background(), resignTimeout)
+		defer cancelResign()
+
+		if err := election.Resign(resignCtx); err != nil {
+			l.logger.Error("node %s failed to resign etcd election: %s", l.id, err)
+		}
+
+		l.setHasLock(false)
+		return lock.ErrLockClosed
+	case <-session.Done():
+		l.setHasLock(false)
+		return lock.ErrLockFailed
+	}
+}
+
+// failed waits before the next attempt so that an unavailable
+// etcd cluster does not cause a tight retry loop
+func (l *Lock) failed(ctx context.Context) error {
+	l.setHasLock(false)
+
+	select {
+	case <-ctx.Done():
+		if l.isClosed() {
+			return lock.ErrLockClosed
+		}
+	case <-time.After(retryDelay):
+	}
+
+	return lock.ErrLockFailed
+}
+
+// isClosed returns true if the lock was unlocked
+func (l *Lock) isClosed() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.closed
+}
+
+// Unlock stops any lock attempt and waits for the election to be
+// resigned so that another node can acquire the lock immediately
+func (l *Lock) Unlock(ctx context.Context) (err error) {
+	l.logger.Debug("node %s unlocking etcd lock", l.id)
+
+	l.mx.Lock()
+	l.closed = true
+	cancel, done := l.cancel, l.done
+	l.mx.Unlock()
+
+	// the lock was never attempted
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+		l.logger.Debug("node %s unlocked etcd lock", l.id)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	return
+}
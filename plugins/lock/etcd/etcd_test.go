@@ -0,0 +1,80 @@
+package etcd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd/etcdtest"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock/etcd"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func TestLock(t *testing.T) {
+	config := etcdtest.Start(t)
+
+	logger := logging.NewStandardLogger()
+	logger.SetLevel(logging.Debug)
+
+	newLock := func() (lock.Lock, chan error) {
+		l, err := etcd.NewLock(&lock.Options{
+			Config: etcd.Config{
+				Key:  "test-lock",
+				TTL:  "2s",
+				Etcd: config,
+			},
+			Logger: logger,
+		})
+		if err != nil {
+			t.Fatalf("failed to create new etcd lock: %s", err)
+		}
+
+		if err := l.Connect(context.Background()); err != nil {
+			t.Fatalf("connect error %s", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- lock.Acquire(context.Background(), l) }()
+		return l, done
+	}
+
+	// waitFor waits for the lock to reach the expected state
+	waitFor := func(l lock.Lock, hasLock bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for l.HasLock() != hasLock {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected lock held to be %t", hasLock)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	first, firstDone := newLock()
+	waitFor(first, true)
+
+	second, secondDone := newLock()
+	time.Sleep(500 * time.Millisecond)
+	if second.HasLock() {
+		t.Fatal("expected only one node to hold the lock")
+	}
+
+	if err := first.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock error: %s", err)
+	}
+	if err := <-firstDone; err != nil {
+		t.Errorf("acquire error: %s", err)
+	}
+	first.Disconnect(context.Background())
+
+	waitFor(first, false)
+	waitFor(second, true)
+
+	if err := second.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock error: %s", err)
+	}
+	if err := <-secondDone; err != nil {
+		t.Errorf("acquire error: %s", err)
+	}
+	second.Disconnect(context.Background())
+}
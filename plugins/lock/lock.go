@@ -16,8 +16,9 @@ var (
 type NewLockFunc func(opts *Options) (Lock, error)
 
 type Options struct {
-	Config interface{}
-	Logger logger.Logger
+	Config   interface{}
+	Logger   logger.Logger
+	Callback func(hasLock bool)
 }
 
 type Lock interface {
@@ -0,0 +1,285 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	ProviderName   = "redis"
+	DefaultKey     = "opa-bundle-server/lock"
+	DefaultTTL     = "15s"
+	retryDelay     = time.Second
+	releaseTimeout = 5 * time.Second
+)
+
+var (
+	// renewScript extends the ttl if the lock is still held by the node
+	renewScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseScript deletes the lock if it is still held by the node
+	releaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+func init() {
+	lock.Providers[ProviderName] = NewLock
+}
+
+type Lock struct {
+	id      string
+	mx      sync.Mutex
+	hasLock bool
+	closed  bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	client  *redis.Client
+	config  *Config
+	logger  logger.Logger
+	ttl     time.Duration
+	cb      func(hasLock bool)
+}
+
+type Config struct {
+	Key   string        `json:"key" yaml:"key"`
+	TTL   string        `json:"ttl" yaml:"ttl"`
+	Redis *redis.Config `json:"redis" yaml:"redis"`
+}
+
+// NewLock creates a new lock manager
+func NewLock(opts *lock.Options) (lock.Lock, error) {
+	l := &Lock{
+		id:     uuid.NewString(),
+		config: &Config{},
+		logger: opts.Logger,
+		cb:     opts.Callback,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("node %s invalid configuration for redis lock", l.id)
+	}
+
+	if err := utils.ReMarshal(opts.Config, l.config); err != nil {
+		return nil, err
+	}
+
+	if l.config.Redis == nil {
+		return nil, fmt.Errorf("node %s no redis configuration provided for redis lock", l.id)
+	}
+
+	if l.config.Key == "" {
+		l.config.Key = DefaultKey
+	}
+
+	if l.config.TTL == "" {
+		l.config.TTL = DefaultTTL
+	}
+
+	var err error
+	if l.ttl, err = time.ParseDuration(l.config.TTL); err != nil {
+		return nil, fmt.Errorf("node %s invalid ttl for redis lock: %s", l.id, err)
+	}
+
+	if l.ttl < time.Second {
+		return nil, fmt.Errorf("node %s redis lock ttl must be at least 1s", l.id)
+	}
+
+	return l, nil
+}
+
+// HasLock lock is held by this node
+func (l *Lock) HasLock() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.hasLock
+}
+
+// Connect connects to redis
+func (l *Lock) Connect(ctx context.Context) (err error) {
+	l.logger.Debug("node %s connecting to redis lock", l.id)
+	if l.client != nil {
+		return fmt.Errorf("node %s already connected", l.id)
+	}
+
+	l.client, err = redis.NewClient(l.config.Redis)
+	return
+}
+
+// Disconnect disconnects from redis
+func (l *Lock) Disconnect(ctx context.Context) (err error) {
+	if l.client == nil {
+		err = fmt.Errorf("node %s not connected", l.id)
+		return
+	}
+
+	err = l.client.Close()
+	l.client = nil
+	return
+}
+
+// setHasLock sets the has lock property
+func (l *Lock) setHasLock(hasLock bool) {
+	l.mx.Lock()
+	prev := l.hasLock
+	l.hasLock = hasLock
+	l.mx.Unlock()
+
+	if hasLock {
+		l.logger.Debug("node %s acquired lock", l.id)
+	} else if prev {
+		l.logger.Debug("node %s lock lost", l.id)
+	} else {
+		l.logger.Debug("node %s failed to acquire lock", l.id)
+	}
+
+	if l.cb != nil && prev != hasLock {
+		l.cb(hasLock)
+	}
+}
+
+// Lock sets the lock key to the node id if it does not exist. The
+// key expires after the ttl and is renewed while the lock is held
+func (l *Lock) Lock(ctx context.Context) (err error) {
+	l.mx.Lock()
+	if l.closed {
+		l.mx.Unlock()
+		return lock.ErrLockClosed
+	}
+	lockCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	l.cancel, l.done = cancel, done
+	l.mx.Unlock()
+	defer close(done)
+	defer cancel()
+
+	ok, err := l.client.Redis().SetNX(lockCtx, l.config.Key, l.id, l.ttl).Result()
+	if err != nil {
+		l.logger.Error("node %s failed to set redis lock: %s", l.id, err)
+		return l.failed(lockCtx)
+	} else if !ok {
+		return l.failed(lockCtx)
+	}
+
+	l.setHasLock(true)
+
+	renewed := time.Now()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lockCtx.Done():
+			l.release()
+			l.setHasLock(false)
+			return lock.ErrLockClosed
+
+		case <-ticker.C:
+			held, err := l.renew(lockCtx)
+			switch {
+			case err == nil && held:
+				renewed = time.Now()
+			case err == nil:
+				// the key expired or was taken by another node
+				l.setHasLock(false)
+				return lock.ErrLockFailed
+			case time.Since(renewed) >= l.ttl-l.ttl/3:
+				// give up before the key expires so that another
+				// node cannot acquire it while this node is leader
+				l.logger.Error("node %s failed to renew redis lock: %s", l.id, err)
+				l.setHasLock(false)
+				return lock.ErrLockFailed
+			default:
+				l.logger.Warn("node %s failed to renew redis lock, retrying: %s", l.id, err)
+			}
+		}
+	}
+}
+
+// renew extends the ttl of the lock and returns true if it is still held
+func (l *Lock) renew(ctx context.Context) (bool, error) {
+	n, err := renewScript.Run(
+		ctx,
+		l.client.Redis(),
+		[]string{l.config.Key},
+		l.id,
+		l.ttl.Milliseconds(),
+	).Int()
+	return n == 1, err
+}
+
+// release deletes the lock so that another node can acquire it
+// without waiting for the ttl to expire
+func (l *Lock) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := releaseScript.Run(ctx, l.client.Redis(), []string{l.config.Key}, l.id).Err(); err != nil {
+		l.logger.Error("node %s failed to release redis lock: %s", l.id, err)
+	}
+}
+
+// failed waits before the next attempt so that an unavailable
+// redis server does not cause a tight retry loop
+func (l *Lock) failed(ctx context.Context) error {
+	l.setHasLock(false)
+
+	select {
+	case <-ctx.Done():
+		if l.isClosed() {
+			return lock.ErrLockClosed
+		}
+	case <-time.After(retryDelay):
+	}
+
+	return lock.ErrLockFailed
+}
+
+// isClosed returns true if the lock was unlocked
+func (l *Lock) isClosed() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.closed
+}
+
+// Unlock stops any lock attempt and waits for the lock to be
+// released so that another node can acquire it immediately
+func (l *Lock) Unlock(ctx context.Context) (err error) {
+	l.logger.Debug("node %s unlocking redis lock", l.id)
+
+	l.mx.Lock()
+	l.closed = true
+	cancel, done := l.cancel, l.done
+	l.mx.Unlock()
+
+	// the lock was never attempted
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+		l.logger.Debug("node %s unlocked redis lock", l.id)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	return
+}
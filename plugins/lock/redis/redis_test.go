@@ -0,0 +1,171 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/lock/redis"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func TestLock(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %s", err)
+	}
+	defer mr.Close()
+
+	logger := logging.NewStandardLogger()
+	logger.SetLevel(logging.Debug)
+
+	newLock := func() (lock.Lock, chan error) {
+		l, err := redis.NewLock(&lock.Options{
+			Config: redis.Config{
+				Key: "test-lock",
+				TTL: "1s",
+				Redis: &client.Config{
+					Address: mr.Addr(),
+				},
+			},
+			Logger: logger,
+		})
+		if err != nil {
+			t.Fatalf("failed to create new redis lock: %s", err)
+		}
+
+		if err := l.Connect(context.Background()); err != nil {
+			t.Fatalf("connect error %s", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- lock.Acquire(context.Background(), l) }()
+		return l, done
+	}
+
+	// waitFor waits for the lock to reach the expected state
+	waitFor := func(l lock.Lock, hasLock bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for l.HasLock() != hasLock {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected lock held to be %t", hasLock)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	first, firstDone := newLock()
+	waitFor(first, true)
+
+	second, secondDone := newLock()
+	time.Sleep(1500 * time.Millisecond)
+	if second.HasLock() {
+		t.Fatal("expected the lock to be renewed by the first node")
+	}
+
+	// the first node loses the lock if the key is taken
+	mr.Set("test-lock", "other")
+	waitFor(first, false)
+	mr.Del("test-lock")
+
+	// either node can acquire the released key
+	deadline := time.Now().Add(5 * time.Second)
+	for !first.HasLock() && !second.HasLock() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a node to acquire the lock")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	holder, holderDone, other, otherDone := first, firstDone, second, secondDone
+	if second.HasLock() {
+		holder, holderDone, other, otherDone = second, secondDone, first, firstDone
+	}
+
+	if err := holder.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock error: %s", err)
+	}
+	if err := <-holderDone; err != nil {
+		t.Errorf("acquire error: %s", err)
+	}
+	holder.Disconnect(context.Background())
+
+	waitFor(other, true)
+
+	if err := other.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock error: %s", err)
+	}
+	if err := <-otherDone; err != nil {
+		t.Errorf("acquire error: %s", err)
+	}
+	other.Disconnect(context.Background())
+
+	if mr.Exists("test-lock") {
+		t.Error("expected the lock to be released")
+	}
+}
+
+func TestRenewFailure(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %s", err)
+	}
+	defer mr.Close()
+
+	acquired := make(chan struct{})
+	l, err := redis.NewLock(&lock.Options{
+		Config: redis.Config{
+			Key: "test-lock",
+			TTL: "3s",
+			Redis: &client.Config{
+				Address: mr.Addr(),
+			},
+		},
+		Logger: logging.NewNoOpLogger(),
+		Callback: func(hasLock bool) {
+			if hasLock {
+				// fail every renewal
+				mr.SetError("unavailable")
+				close(acquired)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create new redis lock: %s", err)
+	}
+
+	if err := l.Connect(context.Background()); err != nil {
+		t.Fatalf("connect error %s", err)
+	}
+	defer l.Disconnect(context.Background())
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- l.Lock(context.Background()) }()
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be acquired")
+	}
+
+	// leadership must be given up before the key expires
+	select {
+	case err := <-done:
+		if err != lock.ErrLockFailed {
+			t.Errorf("expected %v, got %v", lock.ErrLockFailed, err)
+		}
+		if elapsed := time.Since(start); elapsed >= 3*time.Second {
+			t.Errorf("expected the lock to be given up before the ttl, took %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be given up")
+	}
+
+	if l.HasLock() {
+		t.Error("expected the lock to not be held")
+	}
+}
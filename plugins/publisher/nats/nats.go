@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/nats"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+const (
+	ProviderName   = "nats"
+	DefaultTimeout = "5s"
+)
+
+func init() {
+	publisher.Providers[ProviderName] = NewPublisher
+}
+
+type Publisher struct {
+	name    string
+	client  *nats.Client
+	config  *Config
+	logger  logger.Logger
+	timeout time.Duration
+}
+
+// Config configures the subject messages are published to. When
+// jetstream is set the message must be stored by a stream
+type Config struct {
+	Topic     string       `json:"topic" yaml:"topic"`
+	JetStream bool         `json:"jetstream" yaml:"jetstream"`
+	Timeout   string       `json:"timeout" yaml:"timeout"`
+	NATS      *nats.Config `json:"nats" yaml:"nats"`
+}
+
+// NewPublisher creates a new publisher
+func NewPublisher(opts *publisher.Options) (publisher.Publisher, error) {
+	p := &Publisher{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for publisher %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, p.config); err != nil {
+		return nil, err
+	}
+
+	if p.config.NATS == nil {
+		return nil, fmt.Errorf("no nats configuration provided for publisher %s", opts.Name)
+	}
+
+	if p.config.Topic == "" {
+		return nil, fmt.Errorf("no topic specified for nats publisher %s", p.name)
+	}
+
+	if p.config.Timeout == "" {
+		p.config.Timeout = DefaultTimeout
+	}
+
+	var err error
+	if p.timeout, err = time.ParseDuration(p.config.Timeout); err != nil {
+		return nil, fmt.Errorf("invalid timeout for nats publisher %s: %s", p.name, err)
+	}
+
+	return p, nil
+}
+
+func (p *Publisher) Connect(ctx context.Context) (err error) {
+	p.logger.Debug("connecting to nats publisher %s", p.name)
+	if p.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	p.client, err = nats.NewClient(p.config.NATS)
+	return
+}
+
+func (p *Publisher) Disconnect(ctx context.Context) (err error) {
+	if p.client == nil {
+		err = fmt.Errorf("not connected")
+		return
+	}
+
+	err = p.client.Close()
+	p.client = nil
+	return
+}
+
+// Publish publishes a message to a subject and waits for the server
+// to receive it, or for the stream to store it with jetstream
+func (p *Publisher) Publish(ctx context.Context, payload []byte) (err error) {
+	p.logger.Debug("publishing message to subject %s", p.config.Topic)
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if p.config.JetStream {
+		var js natsgo.JetStreamContext
+		if js, err = p.client.JetStream(); err == nil {
+			_, err = js.Publish(p.config.Topic, payload, natsgo.Context(ctx))
+		}
+	} else if err = p.client.NATS().Publish(p.config.Topic, payload); err == nil {
+		err = p.client.NATS().FlushWithContext(ctx)
+	}
+
+	if err != nil {
+		p.logger.Error("failed to publish message to subject %s on publisher %s: %s", p.config.Topic, p.name, err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,103 @@
+package nats_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/nats"
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/nats/natstest"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher/nats"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+const payload = `{"etag":"abc"}`
+
+func publish(t *testing.T, config nats.Config) {
+	p, err := nats.NewPublisher(&publisher.Options{
+		Name:   "test",
+		Config: config,
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create nats publisher: %s", err)
+	}
+
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect nats publisher: %s", err)
+	}
+	defer p.Disconnect(context.Background())
+
+	if err := p.Publish(context.Background(), []byte(payload)); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	config := natstest.Start(t, "secret")
+
+	c, err := client.NewClient(config)
+	if err != nil {
+		t.Fatalf("failed to connect to nats: %s", err)
+	}
+	defer c.Close()
+
+	sub, err := c.NATS().SubscribeSync("bundles")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+	c.NATS().Flush()
+
+	publish(t, nats.Config{
+		Topic: "bundles",
+		NATS:  config,
+	})
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("expected a message to be published: %s", err)
+	}
+
+	if string(msg.Data) != payload {
+		t.Errorf("expected payload %s, got %s", payload, msg.Data)
+	}
+}
+
+func TestJetStream(t *testing.T) {
+	config := natstest.Start(t, "")
+
+	c, err := client.NewClient(config)
+	if err != nil {
+		t.Fatalf("failed to connect to nats: %s", err)
+	}
+	defer c.Close()
+
+	js, err := c.JetStream()
+	if err != nil {
+		t.Fatalf("failed to get jetstream context: %s", err)
+	}
+
+	if _, err := js.AddStream(&natsgo.StreamConfig{
+		Name:     "BUNDLES",
+		Subjects: []string{"bundles"},
+	}); err != nil {
+		t.Fatalf("failed to create stream: %s", err)
+	}
+
+	publish(t, nats.Config{
+		Topic:     "bundles",
+		JetStream: true,
+		NATS:      config,
+	})
+
+	msg, err := js.GetMsg("BUNDLES", 1)
+	if err != nil {
+		t.Fatalf("expected the message to be stored: %s", err)
+	}
+
+	if string(msg.Data) != payload {
+		t.Errorf("expected payload %s, got %s", payload, msg.Data)
+	}
+}
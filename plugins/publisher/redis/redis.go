@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher"
+)
+
+const (
+	ProviderName = "redis"
+)
+
+func init() {
+	publisher.Providers[ProviderName] = NewPublisher
+}
+
+type Publisher struct {
+	name   string
+	client *redis.Client
+	config *Config
+	logger logger.Logger
+}
+
+type Config struct {
+	Topic string        `json:"topic" yaml:"topic"`
+	Redis *redis.Config `json:"redis" yaml:"redis"`
+}
+
+// NewPublisher creates a new publisher
+func NewPublisher(opts *publisher.Options) (publisher.Publisher, error) {
+	p := &Publisher{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for publisher %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, p.config); err != nil {
+		return nil, err
+	}
+
+	if p.config.Redis == nil {
+		return nil, fmt.Errorf("no redis configuration provided for publisher %s", opts.Name)
+	}
+
+	if p.config.Topic == "" {
+		return nil, fmt.Errorf("no topic specified for redis publisher %s", p.name)
+	}
+
+	return p, nil
+}
+
+func (p *Publisher) Connect(ctx context.Context) (err error) {
+	p.logger.Debug("connecting to redis publisher %s", p.name)
+	if p.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	p.client, err = redis.NewClient(p.config.Redis)
+	return
+}
+
+func (p *Publisher) Disconnect(ctx context.Context) (err error) {
+	if p.client == nil {
+		err = fmt.Errorf("not connected")
+		return
+	}
+
+	err = p.client.Close()
+	p.client = nil
+	return
+}
+
+// Publish publishes a message to a channel
+func (p *Publisher) Publish(ctx context.Context, payload []byte) (err error) {
+	p.logger.Debug("publishing message to channel %s", p.config.Topic)
+
+	var receivers int64
+	if receivers, err = p.client.Redis().Publish(ctx, p.config.Topic, payload).Result(); err != nil {
+		p.logger.Error("failed to publish message to channel %s on publisher %s: %s", p.config.Topic, p.name, err)
+		return
+	}
+
+	p.logger.Debug("published message to %d subscribers of channel %s", receivers, p.config.Topic)
+	return
+}
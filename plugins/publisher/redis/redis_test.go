@@ -0,0 +1,69 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/publisher/redis"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %s", err)
+	}
+	defer mr.Close()
+
+	config := &client.Config{
+		Address: mr.Addr(),
+	}
+
+	c, err := client.NewClient(config)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %s", err)
+	}
+	defer c.Close()
+
+	sub := c.Redis().Subscribe(ctx, "bundles")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+
+	p, err := redis.NewPublisher(&publisher.Options{
+		Name: "test",
+		Config: redis.Config{
+			Topic: "bundles",
+			Redis: config,
+		},
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create redis publisher: %s", err)
+	}
+
+	if err := p.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect redis publisher: %s", err)
+	}
+	defer p.Disconnect(ctx)
+
+	payload := `{"etag":"abc"}`
+	if err := p.Publish(ctx, []byte(payload)); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+
+	select {
+	case msg := <-sub.Channel():
+		if msg.Payload != payload {
+			t.Errorf("expected payload %s, got %s", payload, msg.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a message to be published")
+	}
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+// compileModules compiles the bundle modules
+func compileModules(b *bundle.Bundle, capabilities *ast.Capabilities) (*ast.Compiler, error) {
+	modules := map[string]*ast.Module{}
+	for _, module := range b.Modules {
+		modules[module.Path] = module.Parsed
+	}
+
+	compiler := ast.NewCompiler().WithCapabilities(capabilities)
+	if compiler.Compile(modules); compiler.Failed() {
+		return nil, compiler.Errors
+	}
+
+	return compiler, nil
+}
+
+// entrypointRules returns the rules for an entrypoint in <package>/<rule> format
+func entrypointRules(compiler *ast.Compiler, entrypoint string) ([]*ast.Rule, error) {
+	path, ok := storage.ParsePath("/" + strings.TrimPrefix(entrypoint, "/"))
+	if !ok {
+		return nil, fmt.Errorf("entrypoint %v not valid: use <package>/<rule>", entrypoint)
+	}
+
+	return compiler.GetRulesWithPrefix(path.Ref(ast.DefaultRootDocument)), nil
+}
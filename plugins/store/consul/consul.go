@@ -5,18 +5,24 @@ import (
 	"context"
 	"fmt"
 	"path"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/bep/debounce"
 	"github.com/bhoriuchi/opa-bundle-server/core/clients/consul"
 	"github.com/bhoriuchi/opa-bundle-server/core/logger"
 	"github.com/bhoriuchi/opa-bundle-server/core/utils"
 	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
 	consulapi "github.com/hashicorp/consul/api"
 	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/util"
 )
 
 const (
-	ProviderName = "consul"
+	ProviderName    = "consul"
+	DefaultDebounce = "200ms"
+	maxRetryDelay   = 30 * time.Second
 )
 
 func init() {
@@ -24,15 +30,23 @@ func init() {
 }
 
 type Store struct {
-	name   string
-	client *consul.Client
-	config *Config
-	logger logger.Logger
+	mx       sync.RWMutex
+	name     string
+	client   *consul.Client
+	config   *Config
+	logger   logger.Logger
+	cb       func()
+	debounce func(f func())
+	cancel   context.CancelFunc
 }
 
 type Config struct {
-	Prefix string         `json:"prefix" yaml:"prefix"`
-	Consul *consul.Config `json:"consul" yaml:"consul"`
+	Prefix        string         `json:"prefix" yaml:"prefix"`
+	DataExtension string         `json:"data_extension" yaml:"data_extension"`
+	ManifestKey   string         `json:"manifest_key" yaml:"manifest_key"`
+	Watch         bool           `json:"watch" yaml:"watch"`
+	Debounce      string         `json:"debounce" yaml:"debounce"`
+	Consul        *consul.Config `json:"consul" yaml:"consul"`
 }
 
 // NewStore creates a new store
@@ -41,6 +55,7 @@ func NewStore(opts *store.Options) (store.Store, error) {
 		name:   opts.Name,
 		config: &Config{},
 		logger: opts.Logger,
+		cb:     opts.Callback,
 	}
 
 	if opts.Config == nil {
@@ -59,48 +74,186 @@ func NewStore(opts *store.Options) (store.Store, error) {
 		s.config.Prefix = path.Join("bundles", s.name)
 	}
 
+	if err := s.config.validateLayout(); err != nil {
+		return nil, fmt.Errorf("invalid layout for consul store %s: %s", s.name, err)
+	}
+
+	if s.config.Debounce == "" {
+		s.config.Debounce = DefaultDebounce
+	}
+
+	duration, err := time.ParseDuration(s.config.Debounce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debounce duration for consul store %s: %s", s.name, err)
+	}
+
+	s.debounce = debounce.New(duration)
+
 	return s, nil
 }
 
-// Connect is noop but required to implement store interface
+// Connect creates the consul client and starts watching
+// the prefix if watching is enabled
 func (s *Store) Connect(ctx context.Context) (err error) {
 	s.logger.Debug("connecting to consul store %s at %s", s.name, s.config.Consul.Address)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
 	if s.client != nil {
 		return fmt.Errorf("already connected")
 	}
 
-	s.client, err = consul.NewClient(s.config.Consul)
+	if s.client, err = consul.NewClient(s.config.Consul); err != nil {
+		return
+	}
+
+	if s.config.Watch {
+		var watchCtx context.Context
+		watchCtx, s.cancel = context.WithCancel(context.Background())
+		go s.watch(watchCtx, s.client)
+	}
+
 	return
 }
 
-// Disconnect is noop but required to implement store interface
+// Disconnect stops watching the prefix and removes the client
 func (s *Store) Disconnect(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
 	if s.client == nil {
 		return fmt.Errorf("not connected")
 	}
 
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+
+	s.client = nil
 	return
 }
 
+// watch runs blocking queries on the prefix and rebuilds
+// the bundles using the store when its index changes
+func (s *Store) watch(ctx context.Context, client *consul.Client) {
+	var (
+		index uint64
+		retry int
+	)
+
+	s.logger.Debug("consul store %s is watching prefix %s", s.name, s.config.Prefix)
+
+	for {
+		q := (&consulapi.QueryOptions{WaitIndex: index}).WithContext(ctx)
+		_, meta, err := client.Consul().KV().Keys(s.config.listPrefix(), "", q)
+
+		if ctx.Err() != nil {
+			s.logger.Debug("consul store %s stopped watching prefix %s", s.name, s.config.Prefix)
+			return
+		}
+
+		if err != nil {
+			delay := util.DefaultBackoff(float64(time.Second), float64(maxRetryDelay), retry)
+			s.logger.Error("consul store %s failed to watch prefix %s, retrying in %v: %s", s.name, s.config.Prefix, delay, err)
+			retry++
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		retry = 0
+
+		switch {
+		case index == 0:
+			// the first query only sets the index
+		case meta.LastIndex != index:
+			s.logger.Debug("consul store %s prefix %s changed at index %d", s.name, s.config.Prefix, meta.LastIndex)
+			if s.cb != nil {
+				s.debounce(s.cb)
+			}
+		}
+
+		// follow the index even if it goes backwards, it must
+		// be greater than 0 for the next query to block
+		index = meta.LastIndex
+		if index < 1 {
+			index = 1
+		}
+	}
+}
+
+// Revision returns the modify index of the prefix
+// and the manifest key
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.client == nil {
+		return "", fmt.Errorf("consul store %s is not connected", s.name)
+	}
+
+	_, meta, err := s.client.Consul().KV().Keys(s.config.listPrefix(), "", &consulapi.QueryOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	index := meta.LastIndex
+	if s.config.ManifestKey != "" {
+		_, meta, err := s.client.Consul().KV().Get(s.config.ManifestKey, &consulapi.QueryOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		if meta.LastIndex > index {
+			index = meta.LastIndex
+		}
+	}
+
+	return strconv.FormatUint(index, 10), nil
+}
+
 // Bundle
-func (s *Store) Bundle(ctx context.Context) ([]byte, error) {
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.client == nil {
+		return nil, fmt.Errorf("consul store %s is not connected", s.name)
+	}
+
 	s.logger.Debug("listing prefix %s", s.config.Prefix)
-	pairs, _, err := s.client.List(s.config.Prefix, &consulapi.QueryOptions{})
+	pairs, meta, err := s.client.List(s.config.listPrefix(), &consulapi.QueryOptions{})
 	if err != nil {
 		s.logger.Error("failed to list consul store %s: %s", s.name, err)
 		return nil, err
 	}
 
-	list := store.EntryList{}
-	for _, pair := range pairs {
-		key := strings.TrimLeft(pair.Key, "/")
-		key = strings.TrimLeft(key, s.config.Prefix)
-		key = strings.TrimLeft(key, "/")
+	index := meta.LastIndex
+	list := s.config.entries(pairs)
+
+	if s.config.ManifestKey != "" {
+		pair, meta, err := s.client.Consul().KV().Get(s.config.ManifestKey, &consulapi.QueryOptions{})
+		if err != nil {
+			s.logger.Error("failed to get manifest key %s in consul store %s: %s", s.config.ManifestKey, s.name, err)
+			return nil, err
+		}
+
+		if meta.LastIndex > index {
+			index = meta.LastIndex
+		}
 
-		list = append(list, &store.Entry{
-			Key:   key,
-			Value: pair.Value,
-		})
+		if pair != nil {
+			list = append(list, &store.Entry{
+				Key:   bundle.ManifestExt,
+				Value: pair.Value,
+			})
+		}
 	}
 
 	archive, err := store.Archive(ctx, list)
@@ -113,5 +266,6 @@ func (s *Store) Bundle(ctx context.Context) ([]byte, error) {
 		s.config.Consul.Address,
 	)
 
-	return store.Bundle(ctx, loader)
+	revision := strconv.FormatUint(index, 10)
+	return store.Bundle(ctx, loader, opts.WithSourceRevision(revision))
 }
@@ -0,0 +1,167 @@
+package consul_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/consul"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store/consul"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+// fakeKV is a fake consul kv endpoint that supports blocking queries.
+// Blocking queries return when the index changes or after the wait
+// time with the same index
+type fakeKV struct {
+	mx       sync.Mutex
+	index    uint64
+	requests int
+	changed  chan struct{}
+	wait     time.Duration
+}
+
+func newFakeKV(t *testing.T) (*fakeKV, string) {
+	kv := &fakeKV{
+		index:   1,
+		changed: make(chan struct{}),
+		wait:    50 * time.Millisecond,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kv.mx.Lock()
+		kv.requests++
+		changed := kv.changed
+		current := kv.index
+		kv.mx.Unlock()
+
+		if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 && index == current {
+			select {
+			case <-changed:
+			case <-time.After(kv.wait):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		kv.mx.Lock()
+		current = kv.index
+		kv.mx.Unlock()
+
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(current, 10))
+		json.NewEncoder(w).Encode([]string{"opa/policy.rego"})
+	}))
+	t.Cleanup(srv.Close)
+
+	return kv, strings.TrimPrefix(srv.URL, "http://")
+}
+
+// change increments the index and releases the blocking queries
+func (kv *fakeKV) change() {
+	kv.mx.Lock()
+	defer kv.mx.Unlock()
+
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *fakeKV) requestCount() int {
+	kv.mx.Lock()
+	defer kv.mx.Unlock()
+	return kv.requests
+}
+
+// waitFor waits for the condition to be true
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	kv, addr := newFakeKV(t)
+	changes := make(chan struct{}, 10)
+
+	s, err := consul.NewStore(&store.Options{
+		Name: "test",
+		Config: consul.Config{
+			Prefix:   "opa",
+			Watch:    true,
+			Debounce: "20ms",
+			Consul:   &client.Config{Address: addr},
+		},
+		Logger:   logging.NewNoOpLogger(),
+		Callback: func() { changes <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatalf("failed to create consul store: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect consul store: %s", err)
+	}
+
+	// blocking queries that time out with the same index are not changes
+	waitFor(t, "expected the prefix to be watched", func() bool {
+		return kv.requestCount() > 3
+	})
+
+	select {
+	case <-changes:
+		t.Fatal("expected no callback while the index is unchanged")
+	default:
+	}
+
+	kv.change()
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the index change to call the callback")
+	}
+
+	select {
+	case <-changes:
+		t.Error("expected a single callback for the index change")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := s.Disconnect(context.Background()); err != nil {
+		t.Fatalf("failed to disconnect consul store: %s", err)
+	}
+
+	// a request may be in flight when disconnecting
+	time.Sleep(100 * time.Millisecond)
+	requests := kv.requestCount()
+	time.Sleep(200 * time.Millisecond)
+
+	if kv.requestCount() != requests {
+		t.Errorf("expected disconnecting to stop watching the prefix")
+	}
+
+	if _, err := s.Bundle(context.Background(), &store.BuildOptions{}); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Errorf("expected building a disconnected store to fail, got %v", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to reconnect consul store: %s", err)
+	}
+
+	if err := s.Disconnect(context.Background()); err != nil {
+		t.Fatalf("failed to disconnect consul store: %s", err)
+	}
+}
@@ -0,0 +1,89 @@
+package consul
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+var (
+	dataExtensions = map[string]bool{
+		".json": true,
+		".yaml": true,
+		".yml":  true,
+	}
+)
+
+// validateLayout normalizes and validates the layout options
+func (c *Config) validateLayout() error {
+	c.Prefix = strings.Trim(c.Prefix, "/")
+	c.ManifestKey = strings.TrimLeft(c.ManifestKey, "/")
+
+	if c.DataExtension == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(c.DataExtension, ".") {
+		c.DataExtension = "." + c.DataExtension
+	}
+
+	if !dataExtensions[c.DataExtension] {
+		return fmt.Errorf("unsupported data extension %s", c.DataExtension)
+	}
+
+	return nil
+}
+
+// listPrefix is the prefix used to list keys so that
+// keys of sibling prefixes are not included
+func (c *Config) listPrefix() string {
+	if c.Prefix == "" {
+		return ""
+	}
+	return c.Prefix + "/"
+}
+
+// entries maps the keys under the prefix to bundle files. Folder keys are
+// ignored and keys with the data extension are mapped to a data document
+// at the key's path, so users.json becomes users/data.json
+func (c *Config) entries(pairs consulapi.KVPairs) store.EntryList {
+	list := store.EntryList{}
+	prefix := c.listPrefix()
+
+	for _, pair := range pairs {
+		key := strings.TrimLeft(pair.Key, "/")
+		if !strings.HasPrefix(key, prefix) || strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		if c.ManifestKey != "" && key == c.ManifestKey {
+			continue
+		}
+
+		key = strings.TrimPrefix(key, prefix)
+		if c.DataExtension != "" && strings.HasSuffix(key, c.DataExtension) {
+			base := path.Base(key)
+			if base != "data.json" && base != "data.yaml" {
+				key = path.Join(strings.TrimSuffix(key, c.DataExtension), dataFile(c.DataExtension))
+			}
+		}
+
+		list = append(list, &store.Entry{
+			Key:   key,
+			Value: pair.Value,
+		})
+	}
+
+	return list
+}
+
+// dataFile returns the data document file name for the extension
+func dataFile(ext string) string {
+	if ext == ".json" {
+		return "data.json"
+	}
+	return "data.yaml"
+}
@@ -0,0 +1,161 @@
+package consul_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/consul"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store/consul"
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+// serveKV serves the pairs from a fake consul kv endpoint. Every pair is
+// returned when listing so that the store's own filtering is tested
+func serveKV(t *testing.T, pairs map[string]string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		list := consulapi.KVPairs{}
+		for k, v := range pairs {
+			if _, recurse := r.URL.Query()["recurse"]; recurse || k == key {
+				list = append(list, &consulapi.KVPair{Key: k, Value: []byte(v)})
+			}
+		}
+
+		w.Header().Set("X-Consul-Index", "1")
+		if len(list) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(list)
+	}))
+	t.Cleanup(srv.Close)
+
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  consul.Config
+		pairs   map[string]string
+		modules map[string]string
+		data    map[string]interface{}
+	}{
+		{
+			name:   "prefix sharing leading characters with keys",
+			config: consul.Config{Prefix: "opa/"},
+			pairs: map[string]string{
+				"opa/":             "",
+				"opa/policy.rego":  "package policy",
+				"opa/opa/opa.rego": "package opa.opa",
+				"opa2/other.rego":  "package other",
+				"op/a.rego":        "package a",
+			},
+			modules: map[string]string{
+				"/policy.rego":  "package policy",
+				"/opa/opa.rego": "package opa.opa",
+			},
+		},
+		{
+			name:   "nested prefix repeating its name",
+			config: consul.Config{Prefix: "/opa/opa/"},
+			pairs: map[string]string{
+				"opa/opa/opa.rego":  "package opa",
+				"opa/opa.rego":      "package other",
+				"opa/opa2/opa.rego": "package sibling",
+			},
+			modules: map[string]string{
+				"/opa.rego": "package opa",
+			},
+		},
+		{
+			name:   "data extension",
+			config: consul.Config{Prefix: "opa", DataExtension: "json"},
+			pairs: map[string]string{
+				"opa/data.json":       `{"root": true}`,
+				"opa/opa.json":        `{"nested": true}`,
+				"opa/users/data.json": `{"alice": true}`,
+				"opa.json":            `{"sibling": true}`,
+			},
+			data: map[string]interface{}{
+				"root":  true,
+				"opa":   map[string]interface{}{"nested": true},
+				"users": map[string]interface{}{"alice": true},
+			},
+		},
+		{
+			name:   "manifest key under the prefix",
+			config: consul.Config{Prefix: "opa", DataExtension: "json", ManifestKey: "/opa/manifest.json"},
+			pairs: map[string]string{
+				"opa/manifest.json": `{"roots": [""]}`,
+				"opa/users.json":    `{"alice": true}`,
+			},
+			data: map[string]interface{}{
+				"users": map[string]interface{}{"alice": true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			addr := serveKV(t, tt.pairs)
+			tt.config.Consul = &client.Config{Address: addr}
+
+			s, err := consul.NewStore(&store.Options{
+				Name:   "test",
+				Config: tt.config,
+				Logger: logging.NewNoOpLogger(),
+			})
+			if err != nil {
+				t.Fatalf("failed to create consul store: %s", err)
+			}
+
+			if err := s.Connect(ctx); err != nil {
+				t.Fatalf("failed to connect consul store: %s", err)
+			}
+			defer s.Disconnect(ctx)
+
+			data, err := s.Bundle(ctx, nil)
+			if err != nil {
+				t.Fatalf("failed to build bundle: %s", err)
+			}
+
+			b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+			if err != nil {
+				t.Fatalf("failed to read bundle: %s", err)
+			}
+
+			modules := map[string]string{}
+			for _, module := range b.Modules {
+				// module paths include the consul address as the base url
+				path := strings.TrimPrefix(module.Path, "/"+addr)
+				modules[path] = strings.TrimSpace(string(module.Raw))
+			}
+
+			if tt.modules == nil {
+				tt.modules = map[string]string{}
+			}
+			if !reflect.DeepEqual(modules, tt.modules) {
+				t.Errorf("expected modules %v, got %v", tt.modules, modules)
+			}
+
+			if tt.data == nil {
+				tt.data = map[string]interface{}{}
+			}
+			if !reflect.DeepEqual(b.Data, tt.data) {
+				t.Errorf("expected data %v, got %v", tt.data, b.Data)
+			}
+		})
+	}
+}
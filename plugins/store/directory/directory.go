@@ -2,7 +2,11 @@ package directory
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 
 	"github.com/bhoriuchi/opa-bundle-server/core/logger"
@@ -59,13 +63,58 @@ func (s *Store) Disconnect(ctx context.Context) (err error) {
 	return
 }
 
+// Revision returns the hash of the directory contents
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	dir, err := filepath.Abs(s.config.Directory)
+	if err != nil {
+		return "", err
+	}
+
+	return hash(dir)
+}
+
 // Bundle
-func (s *Store) Bundle(ctx context.Context) ([]byte, error) {
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
 	dir, err := filepath.Abs(s.config.Directory)
 	if err != nil {
 		return nil, err
 	}
 
+	revision, err := hash(dir)
+	if err != nil {
+		return nil, err
+	}
+
 	loader := bundle.NewDirectoryLoader(dir)
-	return store.Bundle(ctx, loader)
+	return store.Bundle(ctx, loader, opts.WithSourceRevision(revision))
+}
+
+// hash returns the sha256 sum of the file paths and contents in the directory
+func hash(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
@@ -0,0 +1,174 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/bundle"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	ProviderName = "etcd"
+)
+
+func init() {
+	store.Providers[ProviderName] = NewStore
+}
+
+type Store struct {
+	mx     sync.RWMutex
+	name   string
+	client *etcd.Client
+	config *Config
+	logger logger.Logger
+}
+
+type Config struct {
+	Prefix string       `json:"prefix" yaml:"prefix"`
+	Etcd   *etcd.Config `json:"etcd" yaml:"etcd"`
+}
+
+// NewStore creates a new store
+func NewStore(opts *store.Options) (store.Store, error) {
+	s := &Store{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for store %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.Etcd == nil {
+		return nil, fmt.Errorf("no etcd configuration provided for store %s", opts.Name)
+	}
+
+	if s.config.Prefix == "" {
+		s.config.Prefix = path.Join("bundles", s.name)
+	}
+
+	// keys are listed with a trailing slash so that
+	// keys of sibling prefixes are not included
+	s.config.Prefix = strings.TrimRight(s.config.Prefix, "/") + "/"
+
+	return s, nil
+}
+
+// Connect creates the etcd client
+func (s *Store) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to etcd store %s at %v", s.name, s.config.Etcd.Endpoints)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	s.client, err = etcd.NewClient(s.config.Etcd)
+	return
+}
+
+// Disconnect closes the etcd client
+func (s *Store) Disconnect(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	err = s.client.Close()
+	s.client = nil
+	return
+}
+
+// Revision returns the latest modify revision and the number of keys
+// under the prefix so that deleted keys are detected as a change
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.client == nil {
+		return "", fmt.Errorf("etcd store %s is not connected", s.name)
+	}
+
+	resp, err := s.client.Etcd().Get(ctx, s.config.Prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d/%d", modRevision(resp), resp.Count), nil
+}
+
+// Bundle builds the bundle from the keys under the prefix. The
+// latest modify revision is used as the bundle revision
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.client == nil {
+		return nil, fmt.Errorf("etcd store %s is not connected", s.name)
+	}
+
+	s.logger.Debug("listing prefix %s", s.config.Prefix)
+	resp, err := s.client.Etcd().Get(ctx, s.config.Prefix, clientv3.WithPrefix())
+	if err != nil {
+		s.logger.Error("failed to list etcd store %s: %s", s.name, err)
+		return nil, err
+	}
+
+	list := store.EntryList{}
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), s.config.Prefix)
+
+		// ignore folder keys
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		list = append(list, &store.Entry{
+			Key:   key,
+			Value: kv.Value,
+		})
+	}
+
+	archive, err := store.Archive(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := bundle.NewTarballLoaderWithBaseURL(
+		bytes.NewReader(archive),
+		"",
+	)
+
+	revision := strconv.FormatInt(modRevision(resp), 10)
+	return store.Bundle(ctx, loader, opts.WithSourceRevision(revision))
+}
+
+// modRevision returns the latest modify revision of the keys
+func modRevision(resp *clientv3.GetResponse) int64 {
+	var revision int64
+	for _, kv := range resp.Kvs {
+		if kv.ModRevision > revision {
+			revision = kv.ModRevision
+		}
+	}
+	return revision
+}
@@ -0,0 +1,130 @@
+package etcd_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd/etcdtest"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store/etcd"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func TestBundle(t *testing.T) {
+	ctx := context.Background()
+	config := etcdtest.Start(t)
+
+	client, err := config.Client()
+	if err != nil {
+		t.Fatalf("failed to create etcd client: %s", err)
+	}
+	defer client.Close()
+
+	for key, value := range map[string]string{
+		"bundles/authz/authz/policy.rego": "package authz\n\nallow { data.users[input.user] }",
+		"bundles/authz/users/data.json":   `{"alice": true}`,
+		"bundles/authz/users/":            "",
+		"bundles/authz2/other.rego":       "package other",
+	} {
+		if _, err := client.Put(ctx, key, value); err != nil {
+			t.Fatalf("failed to put %s: %s", key, err)
+		}
+	}
+
+	s, err := etcd.NewStore(&store.Options{
+		Name: "authz",
+		Config: etcd.Config{
+			Etcd: config,
+		},
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create etcd store: %s", err)
+	}
+
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect etcd store: %s", err)
+	}
+	defer s.Disconnect(ctx)
+
+	data, err := s.Bundle(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		t.Fatalf("failed to read bundle: %s", err)
+	}
+
+	if len(b.Modules) != 1 || b.Modules[0].Path != "/authz/policy.rego" {
+		t.Errorf("expected only the authz policy, got %d modules", len(b.Modules))
+	}
+
+	if users, ok := b.Data["users"].(map[string]interface{}); !ok || users["alice"] != true {
+		t.Errorf("expected users data, got %v", b.Data)
+	}
+
+	before, err := s.(store.Revisioner).Revision(ctx)
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+
+	if _, err := client.Delete(ctx, "bundles/authz/users/data.json"); err != nil {
+		t.Fatalf("failed to delete key: %s", err)
+	}
+
+	after, err := s.(store.Revisioner).Revision(ctx)
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+
+	if before == after {
+		t.Errorf("expected revision to change after deleting a key, got %s", after)
+	}
+
+	if _, err := client.Put(ctx, "bundles/authz2/other.rego", "package other2"); err != nil {
+		t.Fatalf("failed to put key: %s", err)
+	}
+
+	sibling, err := s.(store.Revisioner).Revision(ctx)
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+
+	if sibling != after {
+		t.Errorf("expected revision to ignore sibling prefixes, got %s and %s", after, sibling)
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	s, err := etcd.NewStore(&store.Options{
+		Name: "authz",
+		Config: etcd.Config{
+			Etcd: etcdtest.Start(t),
+		},
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create etcd store: %s", err)
+	}
+
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect etcd store: %s", err)
+	}
+
+	if err := s.Disconnect(ctx); err != nil {
+		t.Fatalf("failed to disconnect etcd store: %s", err)
+	}
+
+	if _, err := s.Bundle(ctx, nil); err == nil {
+		t.Errorf("expected an error building a disconnected store")
+	}
+
+	if _, err := s.(store.Revisioner).Revision(ctx); err == nil {
+		t.Errorf("expected an error getting the revision of a disconnected store")
+	}
+}
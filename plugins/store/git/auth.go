@@ -0,0 +1,91 @@
+package git
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultUsername = "git"
+)
+
+// Auth configures authentication with the remote. A token is used for
+// http(s) urls and an ssh key for ssh urls
+type Auth struct {
+	Username              string `json:"username" yaml:"username"`
+	Token                 string `json:"token" yaml:"token"`
+	TokenEnv              string `json:"token_env" yaml:"token_env"`
+	SSHKey                string `json:"ssh_key" yaml:"ssh_key"`
+	SSHKeyFile            string `json:"ssh_key_file" yaml:"ssh_key_file"`
+	SSHKeyPassword        string `json:"ssh_key_password" yaml:"ssh_key_password"`
+	KnownHostsFile        string `json:"known_hosts_file" yaml:"known_hosts_file"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key" yaml:"insecure_ignore_host_key"`
+}
+
+// method creates the transport auth method. Keys and tokens are loaded
+// every time so that rotated credentials are picked up
+func (a *Auth) method() (transport.AuthMethod, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	username := a.Username
+	if username == "" {
+		username = defaultUsername
+	}
+
+	switch {
+	case a.SSHKey != "" || a.SSHKeyFile != "":
+		var (
+			keys *ssh.PublicKeys
+			err  error
+		)
+
+		if a.SSHKeyFile != "" {
+			keys, err = ssh.NewPublicKeysFromFile(username, a.SSHKeyFile, a.SSHKeyPassword)
+		} else {
+			keys, err = ssh.NewPublicKeys(username, []byte(a.SSHKey), a.SSHKeyPassword)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ssh key: %s", err)
+		}
+
+		switch {
+		case a.InsecureIgnoreHostKey:
+			keys.HostKeyCallback = gossh.InsecureIgnoreHostKey()
+		case a.KnownHostsFile != "":
+			if keys.HostKeyCallback, err = ssh.NewKnownHostsCallback(a.KnownHostsFile); err != nil {
+				return nil, fmt.Errorf("failed to load known hosts file: %s", err)
+			}
+		}
+
+		return keys, nil
+
+	case a.TokenEnv != "":
+		token := os.Getenv(a.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("token environment variable %s is not set", a.TokenEnv)
+		}
+		return &http.BasicAuth{Username: username, Password: token}, nil
+
+	case a.Token != "":
+		return &http.BasicAuth{Username: username, Password: a.Token}, nil
+	}
+
+	return nil, nil
+}
+
+// decodeSSHKey decodes a base64 encoded ssh key
+func decodeSSHKey(key string) (string, error) {
+	content, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		content, err = base64.URLEncoding.DecodeString(key)
+	}
+	return string(content), err
+}
@@ -1,21 +1,31 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/bhoriuchi/opa-bundle-server/core/logger"
 	"github.com/bhoriuchi/opa-bundle-server/core/utils"
 	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
-	getter "github.com/hashicorp/go-getter/v2"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/open-policy-agent/opa/bundle"
 )
 
 const (
 	ProviderName = "git"
+	remoteName   = "origin"
+	markerFile   = ".opabs-git"
 )
 
 func init() {
@@ -23,12 +33,33 @@ func init() {
 }
 
 type Store struct {
+	mx     sync.Mutex
 	name   string
 	config *Config
 	logger logger.Logger
+	repo   *git.Repository
+	branch string
+	builds map[string]*build
+}
+
+// build is the last bundle built for a set of build options
+type build struct {
+	commit string
+	data   []byte
 }
 
 type Config struct {
+	URL       string `json:"url" yaml:"url"`
+	Branch    string `json:"branch" yaml:"branch"`
+	Tag       string `json:"tag" yaml:"tag"`
+	Commit    string `json:"commit" yaml:"commit"`
+	Directory string `json:"directory" yaml:"directory"`
+	Depth     int    `json:"depth" yaml:"depth"`
+	WorkDir   string `json:"work_dir" yaml:"work_dir"`
+	Auth      *Auth  `json:"auth" yaml:"auth"`
+
+	// Source is a go-getter style git source and is supported for
+	// compatibility. The url, directory, ref and depth are parsed from it
 	Source  string `json:"source" yaml:"source"`
 	TempDir string `json:"temp_dir" yaml:"temp_dir"`
 }
@@ -39,6 +70,7 @@ func NewStore(opts *store.Options) (store.Store, error) {
 		name:   opts.Name,
 		config: &Config{},
 		logger: opts.Logger,
+		builds: map[string]*build{},
 	}
 
 	if opts.Config == nil {
@@ -49,67 +81,390 @@ func NewStore(opts *store.Options) (store.Store, error) {
 		return nil, err
 	}
 
+	if s.config.Source != "" {
+		if err := parseSource(s.config); err != nil {
+			return nil, fmt.Errorf("invalid source for store %s: %s", opts.Name, err)
+		}
+	}
+
+	if s.config.URL == "" {
+		return nil, fmt.Errorf("no url provided for git store %s", opts.Name)
+	}
+
+	refs := 0
+	for _, ref := range []string{s.config.Branch, s.config.Tag, s.config.Commit} {
+		if ref != "" {
+			refs++
+		}
+	}
+
+	if refs > 1 {
+		return nil, fmt.Errorf("only one of branch, tag, or commit can be set for git store %s", opts.Name)
+	}
+
+	if s.config.WorkDir == "" {
+		parentDir := os.TempDir()
+		if s.config.TempDir != "" {
+			parentDir = s.config.TempDir
+		}
+		s.config.WorkDir = filepath.Join(parentDir, "opabs-git-"+s.name)
+	}
+
 	return s, nil
 }
 
-// Connect is noop but required to implement store interface
+// Connect opens the working copy, creating it if it does not exist
 func (s *Store) Connect(ctx context.Context) (err error) {
 	s.logger.Debug("connecting to git store %s", s.name)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.repo != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	s.repo, err = s.open()
 	return
 }
 
-// Disconnect is noop but required to implement store interface
+// Disconnect closes the working copy. The working copy is kept
+// on disk so that it can be fetched incrementally on restart
 func (s *Store) Disconnect(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.repo == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	s.repo = nil
+	s.builds = map[string]*build{}
 	return
 }
 
-// Bundle
-func (s *Store) Bundle(ctx context.Context) ([]byte, error) {
-	var err error
+// Revision fetches the configured ref and returns its commit
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.repo == nil {
+		return "", fmt.Errorf("git store %s is not connected", s.name)
+	}
+
+	commit, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return commit.Hash.String(), nil
+}
+
+// Bundle fetches the configured ref and builds the bundle from the
+// commit it points to. The previous build is returned if neither the
+// commit nor the build options have changed
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.repo == nil {
+		return nil, fmt.Errorf("git store %s is not connected", s.name)
+	}
 
-	// Get the pwd
-	pwd, err := os.Getwd()
+	commit, err := s.fetch(ctx)
 	if err != nil {
-		s.logger.Error("error getting wd: %s", err)
+		s.logger.Error("failed to fetch git store %s: %s", s.name, err)
+		return nil, err
 	}
 
-	parentDir := os.TempDir()
-	if s.config.TempDir != "" {
-		if parentDir, err = filepath.Abs(s.config.TempDir); err != nil {
+	key, err := optionsKey(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if last, ok := s.builds[key]; ok && last.commit == commit.Hash.String() {
+		s.logger.Debug("commit %s is unchanged in git store %s, skipping build", commit.Hash, s.name)
+		return last.data, nil
+	}
+
+	list, err := s.entries(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := store.Archive(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := bundle.NewTarballLoaderWithBaseURL(
+		bytes.NewReader(archive),
+		s.config.URL,
+	)
+
+	data, err := store.Bundle(ctx, loader, opts.WithSourceRevision(commit.Hash.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("built commit %s in git store %s", commit.Hash, s.name)
+	s.builds[key] = &build{
+		commit: commit.Hash.String(),
+		data:   data,
+	}
+
+	return data, nil
+}
+
+// open opens the working copy or initializes a new one if it does
+// not exist or points to a different url. Only working copies created
+// by the store are ever removed
+func (s *Store) open() (*git.Repository, error) {
+	owned, err := s.owned()
+	if err != nil {
+		return nil, err
+	}
+
+	if owned {
+		repo, err := git.PlainOpen(s.config.WorkDir)
+		if err == nil {
+			remote, err := repo.Remote(remoteName)
+			sameRemote := err == nil && len(remote.Config().URLs) > 0 && remote.Config().URLs[0] == s.config.URL
+
+			// a shallow working copy cannot be deepened so it is
+			// recreated when the full history is needed
+			shallow, err := repo.Storer.Shallow()
+			fullHistory := err == nil && (len(shallow) == 0 || s.depth() != 0)
+
+			if sameRemote && fullHistory {
+				s.logger.Debug("opened working copy %s for git store %s", s.config.WorkDir, s.name)
+				return repo, nil
+			}
+
+			s.logger.Warn("working copy %s for git store %s has a different remote or depth, recreating it", s.config.WorkDir, s.name)
+		} else {
+			s.logger.Warn("failed to open working copy %s for git store %s, recreating it: %s", s.config.WorkDir, s.name, err)
+		}
+
+		if err := os.RemoveAll(s.config.WorkDir); err != nil {
 			return nil, err
 		}
 	}
 
-	dir, err := ioutil.TempDir(parentDir, "opabs-"+s.name+"-*")
+	repo, err := git.PlainInit(s.config.WorkDir, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(s.config.WorkDir, markerFile), []byte(s.name), 0644); err != nil {
+		return nil, err
+	}
+
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: remoteName,
+		URLs: []string{s.config.URL},
+	}); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// owned returns true if the work directory holds a working copy created
+// by this store. An error is returned if the directory is not empty and
+// was not created by this store so that it is never removed
+func (s *Store) owned() (bool, error) {
+	owner, err := ioutil.ReadFile(filepath.Join(s.config.WorkDir, markerFile))
+	if err == nil {
+		if string(owner) != s.name {
+			return false, fmt.Errorf("work_dir %s for git store %s is in use by git store %s", s.config.WorkDir, s.name, owner)
+		}
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	files, err := ioutil.ReadDir(s.config.WorkDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if len(files) > 0 {
+		return false, fmt.Errorf("work_dir %s for git store %s is not empty and was not created by the store", s.config.WorkDir, s.name)
+	}
+
+	return false, nil
+}
+
+// fetch incrementally fetches the configured ref and returns its commit
+func (s *Store) fetch(ctx context.Context) (*object.Commit, error) {
+	auth, err := s.config.Auth.method()
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if err := os.RemoveAll(dir); err != nil {
-			s.logger.Error("failed to clean up temp directory %s for git store %s: %s", dir, s.name, err)
+	opts := &git.FetchOptions{
+		RemoteName: remoteName,
+		Auth:       auth,
+		Depth:      s.depth(),
+		Tags:       git.NoTags,
+	}
+
+	var local plumbing.ReferenceName
+
+	switch {
+	case s.config.Commit != "":
+		// commits never change so only fetch if the commit is missing
+		if commit, err := s.commit(plumbing.NewHash(s.config.Commit)); err == nil {
+			return commit, nil
 		}
-	}()
 
-	req := &getter.Request{
-		Src:     s.config.Source,
-		Dst:     dir,
-		Pwd:     pwd,
-		GetMode: getter.ModeAny,
+		opts.RefSpecs = []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"}
+
+	case s.config.Tag != "":
+		local = plumbing.NewTagReferenceName(s.config.Tag)
+		opts.RefSpecs = []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:%s", local, local))}
+
+	default:
+		// the default branch is only looked up once
+		if s.branch == "" {
+			if s.branch = s.config.Branch; s.branch == "" {
+				if s.branch, err = s.defaultBranch(ctx); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		local = plumbing.NewRemoteReferenceName(remoteName, s.branch)
+		opts.RefSpecs = []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(s.branch), local))}
 	}
 
-	client := getter.DefaultClient
-	client.Getters = []getter.Getter{
-		new(getter.GitGetter),
+	if err := s.repo.FetchContext(ctx, opts); err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
 	}
 
-	res, err := getter.DefaultClient.Get(ctx, req)
+	if s.config.Commit != "" {
+		return s.commit(plumbing.NewHash(s.config.Commit))
+	}
+
+	ref, err := s.repo.Reference(local, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %s", local, err)
+	}
+
+	return s.commit(ref.Hash())
+}
+
+// depth returns the fetch depth. Commits are always fetched
+// with full history because they may not be at the tip of a branch
+func (s *Store) depth() int {
+	if s.config.Commit != "" {
+		return 0
+	}
+	return s.config.Depth
+}
+
+// commit returns the commit for the hash, peeling annotated tags
+func (s *Store) commit(hash plumbing.Hash) (*object.Commit, error) {
+	if tag, err := s.repo.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+
+	return s.repo.CommitObject(hash)
+}
+
+// defaultBranch returns the branch the remote HEAD points to
+func (s *Store) defaultBranch(ctx context.Context) (string, error) {
+	auth, err := s.config.Auth.method()
+	if err != nil {
+		return "", err
+	}
+
+	remote, err := s.repo.Remote(remoteName)
+	if err != nil {
+		return "", err
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", err
+	}
+
+	var head *plumbing.Reference
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+	}
+
+	if head == nil {
+		return "", fmt.Errorf("remote has no HEAD, a branch, tag, or commit must be configured")
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short(), nil
+	}
+
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+			return ref.Name().Short(), nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to find the branch for the remote HEAD")
+}
+
+// entries reads the files in the configured directory of the commit
+func (s *Store) entries(commit *object.Commit) (store.EntryList, error) {
+	tree, err := commit.Tree()
 	if err != nil {
 		return nil, err
 	}
 
-	s.logger.Debug("successfully cloned %s in store %s", res.Dst, s.name)
+	if dir := store.NormalizePath(s.config.Directory); dir != "." && dir != "" {
+		if tree, err = tree.Tree(dir); err != nil {
+			return nil, fmt.Errorf("failed to find directory %s in commit %s: %s", dir, commit.Hash, err)
+		}
+	}
+
+	list := store.EntryList{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !f.Mode.IsFile() {
+			return nil
+		}
+
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		list = append(list, &store.Entry{
+			Key:   f.Name,
+			Value: content,
+		})
+		return nil
+	})
+
+	return list, err
+}
+
+// optionsKey identifies the build options so the
+// previous build can be reused for the same options
+func optionsKey(opts *store.BuildOptions) (string, error) {
+	j, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
 
-	loader := bundle.NewDirectoryLoader(res.Dst)
-	return store.Bundle(ctx, loader)
+	sum := sha256.Sum256(j)
+	return hex.EncodeToString(sum[:]), nil
 }
@@ -0,0 +1,254 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	storegit "github.com/bhoriuchi/opa-bundle-server/plugins/store/git"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+// remote is a local repository served over file://
+type remote struct {
+	dir  string
+	repo *git.Repository
+}
+
+func newRemote(t *testing.T) *remote {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to create remote: %s", err)
+	}
+
+	return &remote{dir: dir, repo: repo}
+}
+
+func (r *remote) url() string {
+	return "file://" + r.dir
+}
+
+// commit writes the policy and commits it, returning the commit hash
+func (r *remote) commit(t *testing.T, policy string) string {
+	if err := ioutil.WriteFile(filepath.Join(r.dir, "policy.rego"), []byte(policy), 0644); err != nil {
+		t.Fatalf("failed to write policy: %s", err)
+	}
+
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %s", err)
+	}
+
+	if _, err := wt.Add("policy.rego"); err != nil {
+		t.Fatalf("failed to add policy: %s", err)
+	}
+
+	hash, err := wt.Commit("update policy", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit policy: %s", err)
+	}
+
+	return hash.String()
+}
+
+func connect(t *testing.T, config storegit.Config) store.Store {
+	s, err := storegit.NewStore(&store.Options{
+		Name:   "test",
+		Config: config,
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create git store: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect git store: %s", err)
+	}
+
+	return s
+}
+
+func revision(t *testing.T, s store.Store) string {
+	r, err := s.(store.Revisioner).Revision(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+	return r
+}
+
+func build(t *testing.T, s store.Store) ([]byte, bundle.Bundle) {
+	data, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		t.Fatalf("failed to read bundle: %s", err)
+	}
+
+	return data, b
+}
+
+func policy(t *testing.T, b bundle.Bundle) string {
+	if len(b.Modules) != 1 {
+		t.Fatalf("expected 1 module, got %d", len(b.Modules))
+	}
+	return string(b.Modules[0].Raw)
+}
+
+func shallow(t *testing.T, dir string) bool {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("failed to open working copy: %s", err)
+	}
+
+	hashes, err := repo.Storer.Shallow()
+	if err != nil {
+		t.Fatalf("failed to read shallow commits: %s", err)
+	}
+
+	return len(hashes) > 0
+}
+
+func TestIncrementalFetch(t *testing.T) {
+	r := newRemote(t)
+	first := r.commit(t, "package a\n\nallow = true")
+	s := connect(t, storegit.Config{URL: r.url(), WorkDir: filepath.Join(t.TempDir(), "work")})
+
+	if rev := revision(t, s); rev != first {
+		t.Fatalf("expected revision %s, got %s", first, rev)
+	}
+
+	_, b := build(t, s)
+	if b.Manifest.Revision != first {
+		t.Errorf("expected manifest revision %s, got %s", first, b.Manifest.Revision)
+	}
+
+	second := r.commit(t, "package a\n\nallow = false")
+	if rev := revision(t, s); rev != second {
+		t.Fatalf("expected revision %s, got %s", second, rev)
+	}
+
+	_, b = build(t, s)
+	if p := policy(t, b); !strings.Contains(p, "allow = false") {
+		t.Errorf("expected the new policy, got %q", p)
+	}
+}
+
+func TestUnchangedRevision(t *testing.T) {
+	r := newRemote(t)
+	commit := r.commit(t, "package a\n\nallow = true")
+	s := connect(t, storegit.Config{URL: r.url(), WorkDir: filepath.Join(t.TempDir(), "work")})
+
+	first, _ := build(t, s)
+	second, _ := build(t, s)
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected the same bundle for an unchanged commit")
+	}
+
+	for i := 0; i < 2; i++ {
+		if rev := revision(t, s); rev != commit {
+			t.Errorf("expected revision %s, got %s", commit, rev)
+		}
+	}
+}
+
+func TestDepthChange(t *testing.T) {
+	r := newRemote(t)
+	r.commit(t, "package a\n\nallow = true")
+	last := r.commit(t, "package a\n\nallow = false")
+	workDir := filepath.Join(t.TempDir(), "work")
+
+	s := connect(t, storegit.Config{URL: r.url(), WorkDir: workDir, Depth: 1})
+	build(t, s)
+	if err := s.Disconnect(context.Background()); err != nil {
+		t.Fatalf("failed to disconnect: %s", err)
+	}
+
+	if !shallow(t, workDir) {
+		t.Fatalf("expected a shallow working copy")
+	}
+
+	// the full history cannot be fetched into a shallow working copy
+	s = connect(t, storegit.Config{URL: r.url(), WorkDir: workDir})
+	_, b := build(t, s)
+	if b.Manifest.Revision != last {
+		t.Errorf("expected manifest revision %s, got %s", last, b.Manifest.Revision)
+	}
+
+	if shallow(t, workDir) {
+		t.Errorf("expected the working copy to be recreated with full history")
+	}
+}
+
+func TestWorkDirNotOwned(t *testing.T) {
+	r := newRemote(t)
+	r.commit(t, "package a\n\nallow = true")
+
+	t.Run("not empty", func(t *testing.T) {
+		workDir := t.TempDir()
+		keep := filepath.Join(workDir, "keep.txt")
+		if err := ioutil.WriteFile(keep, []byte("keep"), 0644); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+
+		s, err := storegit.NewStore(&store.Options{
+			Name:   "test",
+			Config: storegit.Config{URL: r.url(), WorkDir: workDir},
+			Logger: logging.NewNoOpLogger(),
+		})
+		if err != nil {
+			t.Fatalf("failed to create git store: %s", err)
+		}
+
+		if err := s.Connect(context.Background()); err == nil {
+			t.Errorf("expected an error for a work_dir that is not empty")
+		}
+
+		if _, err := os.Stat(keep); err != nil {
+			t.Errorf("expected the work_dir to be left in place: %s", err)
+		}
+	})
+
+	t.Run("other store", func(t *testing.T) {
+		workDir := filepath.Join(t.TempDir(), "work")
+		connect(t, storegit.Config{URL: r.url(), WorkDir: workDir})
+
+		s, err := storegit.NewStore(&store.Options{
+			Name:   "other",
+			Config: storegit.Config{URL: r.url() + "/other", WorkDir: workDir},
+			Logger: logging.NewNoOpLogger(),
+		})
+		if err != nil {
+			t.Fatalf("failed to create git store: %s", err)
+		}
+
+		if err := s.Connect(context.Background()); err == nil {
+			t.Errorf("expected an error for a work_dir used by another store")
+		}
+
+		repo, err := git.PlainOpen(workDir)
+		if err != nil {
+			t.Fatalf("failed to open working copy: %s", err)
+		}
+
+		remote, err := repo.Remote("origin")
+		if err != nil || remote.Config().URLs[0] != r.url() {
+			t.Errorf("expected the working copy of the first store to be left in place")
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	commitRx = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+)
+
+// parseSource parses a go-getter style git source like
+// git::https://github.com/org/repo.git//policies?ref=main&depth=1
+// into the config. Values set in the config take precedence
+func parseSource(c *Config) error {
+	src := strings.TrimPrefix(c.Source, "git::")
+
+	// the subdirectory follows a double slash after the scheme
+	var dir string
+	offset := 0
+	if i := strings.Index(src, "://"); i != -1 {
+		offset = i + 3
+	}
+	if i := strings.Index(src[offset:], "//"); i != -1 {
+		dir = src[offset+i+2:]
+		src = src[:offset+i]
+		if j := strings.Index(dir, "?"); j != -1 {
+			src += dir[j:]
+			dir = dir[:j]
+		}
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return err
+	}
+
+	query := u.Query()
+	ref := query.Get("ref")
+	depth := query.Get("depth")
+	sshKey := query.Get("sshkey")
+	u.RawQuery = ""
+
+	if c.URL == "" {
+		c.URL = u.String()
+	}
+
+	if c.Directory == "" {
+		c.Directory = dir
+	}
+
+	if ref != "" && c.Branch == "" && c.Tag == "" && c.Commit == "" {
+		if commitRx.MatchString(ref) {
+			c.Commit = ref
+		} else {
+			c.Branch = ref
+		}
+	}
+
+	if depth != "" && c.Depth == 0 {
+		if c.Depth, err = strconv.Atoi(depth); err != nil {
+			return err
+		}
+	}
+
+	if sshKey != "" {
+		if c.Auth == nil {
+			c.Auth = &Auth{}
+		}
+
+		if c.Auth.SSHKey == "" && c.Auth.SSHKeyFile == "" {
+			if c.Auth.SSHKey, err = decodeSSHKey(sshKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
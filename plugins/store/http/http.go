@@ -0,0 +1,341 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+const (
+	ProviderName   = "http"
+	DefaultTimeout = "30s"
+
+	FormatTarball = "tarball"
+	FormatRego    = "rego"
+	FormatJSON    = "json"
+	FormatYAML    = "yaml"
+)
+
+func init() {
+	store.Providers[ProviderName] = NewStore
+}
+
+type Store struct {
+	mx     sync.Mutex
+	name   string
+	config *Config
+	logger logger.Logger
+	client *http.Client
+	last   *response
+}
+
+// response is the last successful response used for conditional requests
+type response struct {
+	etag         string
+	lastModified string
+	contentType  string
+	body         []byte
+}
+
+type Config struct {
+	URL     string            `json:"url" yaml:"url"`
+	Format  string            `json:"format" yaml:"format"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	Timeout string            `json:"timeout" yaml:"timeout"`
+	Auth    *Auth             `json:"auth" yaml:"auth"`
+	TLS     *utils.TLSConfig  `json:"tls" yaml:"tls"`
+}
+
+// Auth configures bearer token or basic authentication
+type Auth struct {
+	Token       string `json:"token" yaml:"token"`
+	TokenEnv    string `json:"token_env" yaml:"token_env"`
+	Username    string `json:"username" yaml:"username"`
+	Password    string `json:"password" yaml:"password"`
+	PasswordEnv string `json:"password_env" yaml:"password_env"`
+}
+
+// NewStore creates a new store
+func NewStore(opts *store.Options) (store.Store, error) {
+	s := &Store{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for store %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.URL == "" {
+		return nil, fmt.Errorf("no url provided for http store %s", opts.Name)
+	}
+
+	if _, err := url.Parse(s.config.URL); err != nil {
+		return nil, fmt.Errorf("invalid url for http store %s: %s", opts.Name, err)
+	}
+
+	switch s.config.Format {
+	case "", FormatTarball, FormatRego, FormatJSON, FormatYAML:
+	default:
+		return nil, fmt.Errorf("unsupported format %q for http store %s", s.config.Format, opts.Name)
+	}
+
+	if s.config.Timeout == "" {
+		s.config.Timeout = DefaultTimeout
+	}
+
+	if _, err := time.ParseDuration(s.config.Timeout); err != nil {
+		return nil, fmt.Errorf("invalid timeout for http store %s: %s", opts.Name, err)
+	}
+
+	return s, nil
+}
+
+// Connect creates the http client
+func (s *Store) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to http store %s at %s", s.name, s.config.URL)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	tlsConfig, err := s.config.TLS.Load()
+	if err != nil {
+		return fmt.Errorf("invalid tls configuration: %s", err)
+	}
+
+	timeout, _ := time.ParseDuration(s.config.Timeout)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	s.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+
+	return
+}
+
+// Disconnect closes idle connections
+func (s *Store) Disconnect(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	s.client.CloseIdleConnections()
+	s.client = nil
+	s.last = nil
+	return
+}
+
+// Revision returns the hash of the remote content
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	res, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return hash(res.body), nil
+}
+
+// Bundle fetches the remote content and builds the bundle
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	res, err := s.fetch(ctx)
+	if err != nil {
+		s.logger.Error("failed to fetch http store %s: %s", s.name, err)
+		return nil, err
+	}
+
+	archive := res.body
+	format := s.format(res)
+
+	switch format {
+	case FormatTarball:
+	case FormatRego, FormatJSON, FormatYAML:
+		file := map[string]string{
+			FormatJSON: "data.json",
+			FormatYAML: "data.yaml",
+		}[format]
+
+		if format == FormatRego {
+			u, _ := url.Parse(s.config.URL)
+			if file = path.Base(u.Path); !strings.HasSuffix(file, bundle.RegoExt) {
+				file = s.name + bundle.RegoExt
+			}
+		}
+
+		if archive, err = store.Archive(ctx, store.EntryList{
+			{Key: file, Value: res.body},
+		}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unable to determine the format of %s, set the format in the http store %s config", s.config.URL, s.name)
+	}
+
+	loader := bundle.NewTarballLoaderWithBaseURL(
+		bytes.NewReader(archive),
+		s.config.URL,
+	)
+
+	return store.Bundle(ctx, loader, opts.WithSourceRevision(hash(res.body)))
+}
+
+// fetch makes a conditional request for the content and returns
+// the previous response if the content has not been modified
+func (s *Store) fetch(ctx context.Context) (*response, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client == nil {
+		return nil, fmt.Errorf("http store %s is not connected", s.name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if err := s.config.Auth.apply(req); err != nil {
+		return nil, err
+	}
+
+	if s.last != nil {
+		if s.last.etag != "" {
+			req.Header.Set("If-None-Match", s.last.etag)
+		}
+		if s.last.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.last.lastModified)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && s.last != nil:
+		s.logger.Debug("%s has not been modified in http store %s", s.config.URL, s.name)
+		return s.last, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, s.config.URL)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.last = &response{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		contentType:  resp.Header.Get("Content-Type"),
+		body:         body,
+	}
+
+	return s.last, nil
+}
+
+// format returns the configured format or infers it from
+// the url extension or the response content type
+func (s *Store) format(res *response) string {
+	if s.config.Format != "" {
+		return s.config.Format
+	}
+
+	u, _ := url.Parse(s.config.URL)
+	switch p := strings.ToLower(u.Path); {
+	case strings.HasSuffix(p, ".tar.gz"), strings.HasSuffix(p, ".tgz"):
+		return FormatTarball
+	case strings.HasSuffix(p, bundle.RegoExt):
+		return FormatRego
+	case strings.HasSuffix(p, ".json"):
+		return FormatJSON
+	case strings.HasSuffix(p, ".yaml"), strings.HasSuffix(p, ".yml"):
+		return FormatYAML
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.contentType)
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/x-tar":
+		return FormatTarball
+	case "application/json":
+		return FormatJSON
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return FormatYAML
+	}
+
+	return ""
+}
+
+// apply sets the authorization header on the request. Secrets
+// are loaded every time so that rotated credentials are picked up
+func (a *Auth) apply(req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+
+	token := a.Token
+	if a.TokenEnv != "" {
+		if token = os.Getenv(a.TokenEnv); token == "" {
+			return fmt.Errorf("token environment variable %s is not set", a.TokenEnv)
+		}
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	password := a.Password
+	if a.PasswordEnv != "" {
+		if password = os.Getenv(a.PasswordEnv); password == "" {
+			return fmt.Errorf("password environment variable %s is not set", a.PasswordEnv)
+		}
+	}
+
+	if a.Username != "" {
+		req.SetBasicAuth(a.Username, password)
+	}
+
+	return nil
+}
+
+// hash returns the sha256 sum of the content
+func hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	storehttp "github.com/bhoriuchi/opa-bundle-server/plugins/store/http"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func newStore(t *testing.T, config storehttp.Config) store.Store {
+	s, err := storehttp.NewStore(&store.Options{
+		Name:   "test",
+		Config: config,
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create http store: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect http store: %s", err)
+	}
+
+	return s
+}
+
+func readBundle(t *testing.T, data []byte) bundle.Bundle {
+	b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		t.Fatalf("failed to read bundle: %s", err)
+	}
+	return b
+}
+
+func TestRegoConditionalGet(t *testing.T) {
+	requests, notModified := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Team") != "policy" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("package authz\n\nallow { input.admin }\n"))
+	}))
+	defer srv.Close()
+
+	s := newStore(t, storehttp.Config{
+		URL:     srv.URL + "/policies/authz.rego",
+		Headers: map[string]string{"X-Team": "policy"},
+		Auth:    &storehttp.Auth{Token: "secret"},
+	})
+	defer s.Disconnect(context.Background())
+
+	first, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	second, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Errorf("expected 2 requests with 1 not modified, got %d requests with %d not modified", requests, notModified)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected the unmodified content to build the same bundle")
+	}
+
+	b := readBundle(t, first)
+	if len(b.Modules) != 1 {
+		t.Fatalf("expected 1 module, got %d", len(b.Modules))
+	}
+
+	if b.Manifest.Revision == "" {
+		t.Errorf("expected the manifest revision to be set from the content")
+	}
+}
+
+func TestTarballBasicAuth(t *testing.T) {
+	archive, err := store.Archive(context.Background(), store.EntryList{
+		{Key: "authz/policy.rego", Value: []byte("package authz\n\nallow { data.users[input.user] }\n")},
+		{Key: "users/data.json", Value: []byte(`{"alice": true}`)},
+	})
+	if err != nil {
+		t.Fatalf("failed to create archive: %s", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "opa" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	s := newStore(t, storehttp.Config{
+		URL:  srv.URL + "/bundle",
+		Auth: &storehttp.Auth{Username: "opa", Password: "pass"},
+	})
+	defer s.Disconnect(context.Background())
+
+	data, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	b := readBundle(t, data)
+	if len(b.Modules) != 1 {
+		t.Errorf("expected 1 module, got %d", len(b.Modules))
+	}
+
+	users, ok := b.Data["users"].(map[string]interface{})
+	if !ok || users["alice"] != true {
+		t.Errorf("expected users data in the bundle, got %v", b.Data)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	s := newStore(t, storehttp.Config{URL: srv.URL + "/data.json"})
+	defer s.Disconnect(context.Background())
+
+	if _, err := s.Bundle(context.Background(), nil); err == nil {
+		t.Errorf("expected an error for an unauthorized request")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"users": {"alice": true}}`))
+	}))
+	defer srv.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	s := newStore(t, storehttp.Config{
+		URL: srv.URL + "/data.json",
+		TLS: &utils.TLSConfig{CAPEM: string(ca)},
+	})
+	defer s.Disconnect(context.Background())
+
+	data, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	if _, ok := readBundle(t, data).Data["users"]; !ok {
+		t.Errorf("expected users data in the bundle")
+	}
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/format"
+)
+
+// Prune removes the rules that are not needed to evaluate the entrypoints
+// from the bundle modules. Modules left without any rules are removed
+func Prune(b *bundle.Bundle, capabilities *ast.Capabilities, entrypoints []string) error {
+	if len(entrypoints) == 0 {
+		return fmt.Errorf("prune_unused requires at least one entrypoint")
+	}
+
+	// pruning only needs the rule graph so every known builtin is allowed.
+	// builtins missing from the capabilities are reported after pruning
+	all := &ast.Capabilities{
+		Builtins: append(ast.CapabilitiesForThisVersion().Builtins, capabilities.Builtins...),
+	}
+
+	compiler, err := compileModules(b, all)
+	if err != nil {
+		return err
+	}
+
+	// walk the rule graph from the entrypoints to find every needed rule
+	needed := map[string]struct{}{}
+	queue := []*ast.Rule{}
+	for _, entrypoint := range entrypoints {
+		rules, err := entrypointRules(compiler, entrypoint)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, rules...)
+	}
+
+	for len(queue) > 0 {
+		rule := queue[0]
+		queue = queue[1:]
+
+		key := ruleKey(rule)
+		if _, ok := needed[key]; ok {
+			continue
+		}
+		needed[key] = struct{}{}
+
+		for dep := range compiler.Graph.Dependencies(rule) {
+			queue = append(queue, dep.(*ast.Rule))
+		}
+
+		// else bodies are separate nodes of the rule graph
+		if rule.Else != nil {
+			queue = append(queue, rule.Else)
+		}
+	}
+
+	pruned := []bundle.ModuleFile{}
+	for _, module := range b.Modules {
+		rules := []*ast.Rule{}
+		for _, rule := range module.Parsed.Rules {
+			for node := rule; node != nil; node = node.Else {
+				if _, ok := needed[ruleKey(node)]; ok {
+					rules = append(rules, rule)
+					break
+				}
+			}
+		}
+
+		if len(rules) == 0 {
+			continue
+		}
+
+		if len(rules) != len(module.Parsed.Rules) {
+			parsed := module.Parsed.Copy()
+			parsed.Rules = rules
+			raw, err := format.Ast(parsed)
+			if err != nil {
+				return err
+			}
+
+			module.Parsed = parsed
+			module.Raw = raw
+		}
+
+		pruned = append(pruned, module)
+	}
+
+	b.Modules = pruned
+	return nil
+}
+
+// ruleKey identifies a rule by its location since the compiler
+// works on copies of the bundle modules
+func ruleKey(rule *ast.Rule) string {
+	if rule.Location == nil {
+		return rule.Path().String()
+	}
+	return fmt.Sprintf("%s:%d:%d", rule.Location.File, rule.Location.Row, rule.Location.Col)
+}
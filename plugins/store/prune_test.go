@@ -0,0 +1,180 @@
+package store_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+// parseBundle creates a bundle from rego modules keyed by path
+func parseBundle(t *testing.T, modules map[string]string) *bundle.Bundle {
+	b := &bundle.Bundle{Data: map[string]interface{}{}}
+	for path, raw := range modules {
+		parsed, err := ast.ParseModule(path, raw)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", path, err)
+		}
+
+		b.Modules = append(b.Modules, bundle.ModuleFile{
+			Path:   path,
+			URL:    path,
+			Raw:    []byte(raw),
+			Parsed: parsed,
+		})
+	}
+	return b
+}
+
+// ruleNames returns the sorted names of the rules in each module
+func ruleNames(t *testing.T, modules map[string]string, entrypoints ...string) map[string][]string {
+	b := parseBundle(t, modules)
+	if err := store.Prune(b, ast.CapabilitiesForThisVersion(), entrypoints); err != nil {
+		t.Fatalf("failed to prune bundle: %s", err)
+	}
+
+	names := map[string][]string{}
+	for _, module := range b.Modules {
+		parsed, err := ast.ParseModule(module.Path, string(module.Raw))
+		if err != nil {
+			t.Fatalf("failed to parse pruned module %s: %s", module.Path, err)
+		}
+
+		for _, rule := range parsed.Rules {
+			name := rule.Head.Name.String()
+			if rule.Default {
+				name = "default " + name
+			}
+			names[module.Path] = append(names[module.Path], name)
+		}
+		sort.Strings(names[module.Path])
+	}
+
+	return names
+}
+
+func checkRules(t *testing.T, actual map[string][]string, expected map[string][]string) {
+	if len(actual) != len(expected) {
+		t.Errorf("expected modules %v, got %v", expected, actual)
+		return
+	}
+
+	for path, rules := range expected {
+		if strings.Join(actual[path], ",") != strings.Join(rules, ",") {
+			t.Errorf("expected module %s to have rules %v, got %v", path, rules, actual[path])
+		}
+	}
+}
+
+func TestPruneElse(t *testing.T) {
+	checkRules(t, ruleNames(t, map[string]string{
+		"authz/policy.rego": `package authz
+
+allow {
+	input.admin
+} else = true {
+	fallback
+}
+
+fallback {
+	input.user == "alice"
+}
+
+unused {
+	true
+}`,
+	}, "authz/allow"), map[string][]string{
+		"authz/policy.rego": {"allow", "fallback"},
+	})
+}
+
+func TestPruneDefault(t *testing.T) {
+	checkRules(t, ruleNames(t, map[string]string{
+		"authz/policy.rego": `package authz
+
+default allow = false
+
+allow {
+	input.admin
+}
+
+default unused = false`,
+	}, "authz/allow"), map[string][]string{
+		"authz/policy.rego": {"allow", "default allow"},
+	})
+}
+
+func TestPruneFunctions(t *testing.T) {
+	checkRules(t, ruleNames(t, map[string]string{
+		"authz/policy.rego": `package authz
+
+import data.lib
+
+allow {
+	lib.is_admin(input.user)
+}`,
+		"lib/lib.rego": `package lib
+
+is_admin(user) {
+	admins[user]
+}
+
+admins = {"alice"}
+
+is_guest(user) {
+	user == "guest"
+}`,
+		"other/other.rego": `package other
+
+allow = true`,
+	}, "authz/allow"), map[string][]string{
+		"authz/policy.rego": {"allow"},
+		"lib/lib.rego":      {"admins", "is_admin"},
+	})
+}
+
+func TestPruneDynamicRefs(t *testing.T) {
+	// rules referenced dynamically cannot be resolved so
+	// every rule that could be referenced is kept
+	checkRules(t, ruleNames(t, map[string]string{
+		"authz/policy.rego": `package authz
+
+allow {
+	data.policies[input.policy].allow
+}`,
+		"policies/a.rego": `package policies.a
+
+allow = true`,
+		"policies/b.rego": `package policies.b
+
+allow = false`,
+	}, "authz/allow"), map[string][]string{
+		"authz/policy.rego": {"allow"},
+		"policies/a.rego":   {"allow"},
+		"policies/b.rego":   {"allow"},
+	})
+}
+
+func TestPruneUnchanged(t *testing.T) {
+	// the module is not reformatted when none of its rules are pruned
+	raw := "package authz\n\nallow   {   input.admin   }\n"
+	b := parseBundle(t, map[string]string{"authz/policy.rego": raw})
+
+	if err := store.Prune(b, ast.CapabilitiesForThisVersion(), []string{"authz/allow"}); err != nil {
+		t.Fatalf("failed to prune bundle: %s", err)
+	}
+
+	if len(b.Modules) != 1 || string(b.Modules[0].Raw) != raw {
+		t.Errorf("expected the module to be untouched, got %v", b.Modules)
+	}
+}
+
+func TestPruneNoEntrypoints(t *testing.T) {
+	b := parseBundle(t, map[string]string{"authz/policy.rego": "package authz\n\nallow = true"})
+	if err := store.Prune(b, ast.CapabilitiesForThisVersion(), nil); err == nil {
+		t.Errorf("expected an error without entrypoints")
+	}
+}
@@ -0,0 +1,308 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+const (
+	ProviderName = "redis"
+	scanCount    = 1000
+)
+
+func init() {
+	store.Providers[ProviderName] = NewStore
+}
+
+type Store struct {
+	mx     sync.RWMutex
+	name   string
+	client *redis.Client
+	config *Config
+	logger logger.Logger
+}
+
+// Config configures where the bundle files are read from. Files are
+// either the string keys under prefix or the fields of a hash
+type Config struct {
+	Prefix string        `json:"prefix" yaml:"prefix"`
+	Hash   string        `json:"hash" yaml:"hash"`
+	Redis  *redis.Config `json:"redis" yaml:"redis"`
+}
+
+// NewStore creates a new store
+func NewStore(opts *store.Options) (store.Store, error) {
+	s := &Store{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for store %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.Redis == nil {
+		return nil, fmt.Errorf("no redis configuration provided for store %s", opts.Name)
+	}
+
+	if s.config.Hash != "" && s.config.Prefix != "" {
+		return nil, fmt.Errorf("only one of prefix or hash can be set on redis store %s", opts.Name)
+	}
+
+	if s.config.Hash == "" {
+		if s.config.Prefix == "" {
+			s.config.Prefix = path.Join("bundles", s.name)
+		}
+
+		// keys are listed with a trailing slash so that
+		// keys of sibling prefixes are not included
+		s.config.Prefix = strings.TrimRight(s.config.Prefix, "/") + "/"
+	}
+
+	return s, nil
+}
+
+// Connect creates the redis client
+func (s *Store) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to redis store %s", s.name)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	s.client, err = redis.NewClient(s.config.Redis)
+	return
+}
+
+// Disconnect closes the redis client
+func (s *Store) Disconnect(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	err = s.client.Close()
+	s.client = nil
+	return
+}
+
+// Revision returns a hash of the bundle files. Redis does not track
+// modifications so the files are read, but the build is skipped
+// when they are unchanged
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.client == nil {
+		return "", fmt.Errorf("redis store %s is not connected", s.name)
+	}
+
+	list, err := s.entries(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return hash(list), nil
+}
+
+// Bundle builds the bundle from the keys under the prefix or the
+// fields of the hash. A hash of the files is used as the bundle revision
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.client == nil {
+		return nil, fmt.Errorf("redis store %s is not connected", s.name)
+	}
+
+	list, err := s.entries(ctx)
+	if err != nil {
+		s.logger.Error("failed to read redis store %s: %s", s.name, err)
+		return nil, err
+	}
+
+	archive, err := store.Archive(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := bundle.NewTarballLoaderWithBaseURL(
+		bytes.NewReader(archive),
+		"",
+	)
+
+	return store.Bundle(ctx, loader, opts.WithSourceRevision(hash(list)))
+}
+
+// entries reads the bundle files
+func (s *Store) entries(ctx context.Context) (store.EntryList, error) {
+	if s.config.Hash != "" {
+		return s.hashEntries(ctx)
+	}
+
+	return s.prefixEntries(ctx)
+}
+
+// hashEntries reads the fields of the hash
+func (s *Store) hashEntries(ctx context.Context) (store.EntryList, error) {
+	s.logger.Debug("reading hash %s", s.config.Hash)
+	fields, err := s.client.Redis().HGetAll(ctx, s.config.Hash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := store.EntryList{}
+	for field, value := range fields {
+		key := store.NormalizePath(field)
+		if key == "" || key == "." {
+			continue
+		}
+
+		list = append(list, &store.Entry{
+			Key:   key,
+			Value: []byte(value),
+		})
+	}
+
+	return list, nil
+}
+
+// prefixEntries scans the keys under the prefix and reads their values
+func (s *Store) prefixEntries(ctx context.Context) (store.EntryList, error) {
+	s.logger.Debug("scanning prefix %s", s.config.Prefix)
+	keys, err := s.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*goredis.StringCmd, len(keys))
+	if _, err := s.client.Redis().Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	}); err != nil && err != goredis.Nil && !isWrongType(err) {
+		return nil, err
+	}
+
+	list := store.EntryList{}
+	for i, cmd := range cmds {
+		key := strings.TrimPrefix(keys[i], s.config.Prefix)
+
+		// ignore folder keys
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		value, err := cmd.Bytes()
+		if err != nil {
+			// keys deleted since the scan and keys that
+			// are not strings are not bundle files
+			if err == goredis.Nil || isWrongType(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		list = append(list, &store.Entry{
+			Key:   key,
+			Value: value,
+		})
+	}
+
+	return list, nil
+}
+
+// scan returns the keys under the prefix. Every master is
+// scanned when connected to a cluster
+func (s *Store) scan(ctx context.Context) ([]string, error) {
+	match := redis.EscapePattern(s.config.Prefix) + "*"
+
+	cluster, ok := s.client.Redis().(*goredis.ClusterClient)
+	if !ok {
+		keys, err := scanKeys(ctx, s.client.Redis(), match)
+		return dedupe(keys), err
+	}
+
+	var (
+		mx   sync.Mutex
+		keys []string
+	)
+
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *goredis.Client) error {
+		nodeKeys, err := scanKeys(ctx, client, match)
+		mx.Lock()
+		keys = append(keys, nodeKeys...)
+		mx.Unlock()
+		return err
+	})
+
+	return dedupe(keys), err
+}
+
+// scanKeys returns the keys on a node matching the pattern
+func scanKeys(ctx context.Context, client goredis.Cmdable, match string) ([]string, error) {
+	keys := []string{}
+	iter := client.Scan(ctx, 0, match, scanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// dedupe sorts the keys and removes duplicates since
+// scan can return a key more than once
+func dedupe(keys []string) []string {
+	sort.Strings(keys)
+	out := []string{}
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// isWrongType returns true if the error is caused by reading a
+// key that does not hold a string
+func isWrongType(err error) bool {
+	return strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// hash hashes the sorted bundle files
+func hash(list store.EntryList) string {
+	files := append(store.EntryList{}, list...)
+	sort.Sort(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00", f.Key, len(f.Value))
+		h.Write(f.Value)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
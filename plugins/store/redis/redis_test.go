@@ -0,0 +1,132 @@
+package redis_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store/redis"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+const policy = "package authz\n\nallow { data.users[input.user] }"
+
+func run(t *testing.T) *miniredis.Miniredis {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %s", err)
+	}
+	t.Cleanup(mr.Close)
+	return mr
+}
+
+func setup(t *testing.T, mr *miniredis.Miniredis, config redis.Config) store.Store {
+	config.Redis = &client.Config{
+		Address: mr.Addr(),
+	}
+
+	s, err := redis.NewStore(&store.Options{
+		Name:   "authz",
+		Config: config,
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create redis store: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect redis store: %s", err)
+	}
+	t.Cleanup(func() { s.Disconnect(context.Background()) })
+
+	return s
+}
+
+func readBundle(t *testing.T, s store.Store) bundle.Bundle {
+	data, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		t.Fatalf("failed to read bundle: %s", err)
+	}
+
+	return b
+}
+
+func revision(t *testing.T, s store.Store) string {
+	r, err := s.(store.Revisioner).Revision(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+	return r
+}
+
+func checkBundle(t *testing.T, b bundle.Bundle) {
+	if len(b.Modules) != 1 || b.Modules[0].Path != "/authz/policy.rego" {
+		t.Errorf("expected only the authz policy, got %d modules", len(b.Modules))
+	}
+
+	if users, ok := b.Data["users"].(map[string]interface{}); !ok || users["alice"] != true {
+		t.Errorf("expected users data, got %v", b.Data)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	mr := run(t)
+	mr.Set("bundles/authz/authz/policy.rego", policy)
+	mr.Set("bundles/authz/users/data.json", `{"alice": true}`)
+	mr.Set("bundles/authz/users/", "")
+	mr.Set("bundles/authz2/other.rego", "package other")
+	mr.HSet("bundles/authz/hash", "other.rego", "package other")
+
+	s := setup(t, mr, redis.Config{})
+	checkBundle(t, readBundle(t, s))
+
+	before := revision(t, s)
+	mr.Set("bundles/authz2/other.rego", "package other2")
+	if after := revision(t, s); after != before {
+		t.Errorf("expected revision to ignore sibling prefixes, got %s and %s", before, after)
+	}
+
+	mr.Del("bundles/authz/users/data.json")
+	if after := revision(t, s); after == before {
+		t.Errorf("expected revision to change after deleting a key, got %s", after)
+	}
+}
+
+func TestHash(t *testing.T) {
+	mr := run(t)
+	mr.HSet("bundles", "authz/policy.rego", policy)
+	mr.HSet("bundles", "/users/data.json", `{"alice": true}`)
+
+	s := setup(t, mr, redis.Config{Hash: "bundles"})
+	checkBundle(t, readBundle(t, s))
+
+	before := revision(t, s)
+	mr.HSet("bundles", "authz/policy.rego", policy+"\n")
+	if after := revision(t, s); after == before {
+		t.Errorf("expected revision to change after updating a field, got %s", after)
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	s := setup(t, run(t), redis.Config{})
+	if err := s.Disconnect(context.Background()); err != nil {
+		t.Fatalf("failed to disconnect redis store: %s", err)
+	}
+
+	if _, err := s.Bundle(context.Background(), nil); err == nil {
+		t.Errorf("expected an error building a disconnected store")
+	}
+
+	if _, err := s.(store.Revisioner).Revision(context.Background()); err == nil {
+		t.Errorf("expected an error getting the revision of a disconnected store")
+	}
+}
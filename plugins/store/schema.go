@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SchemaError is returned when a data document does not
+// match the schema declared for its path
+type SchemaError struct {
+	Path   string
+	Errors []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("data document %s does not match its schema: %s", e.Path, strings.Join(e.Errors, "; "))
+}
+
+// Validate validates the bundle data documents against the json schemas
+// keyed by their data path. Paths can be refs like data.users or
+// slash separated paths like users/admins
+func Validate(b *bundle.Bundle, schemas map[string][]byte) error {
+	paths := []string{}
+	for p := range schemas {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		dataPath, err := parseDataPath(p)
+		if err != nil {
+			return fmt.Errorf("invalid schema path %s: %s", p, err)
+		}
+
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schemas[p]))
+		if err != nil {
+			return fmt.Errorf("invalid schema for %s: %s", p, err)
+		}
+
+		doc, ok := lookup(b.Data, dataPath)
+		if !ok {
+			return &SchemaError{Path: p, Errors: []string{"document not found"}}
+		}
+
+		result, err := schema.Validate(gojsonschema.NewGoLoader(doc))
+		if err != nil {
+			return fmt.Errorf("failed to validate %s: %s", p, err)
+		}
+
+		if !result.Valid() {
+			schemaErr := &SchemaError{Path: p, Errors: []string{}}
+			for _, e := range result.Errors() {
+				schemaErr.Errors = append(schemaErr.Errors, e.String())
+			}
+			return schemaErr
+		}
+	}
+
+	return nil
+}
+
+// parseDataPath parses a data ref or slash separated path
+func parseDataPath(p string) (storage.Path, error) {
+	if strings.Contains(p, "/") {
+		dataPath, ok := storage.ParsePath("/" + strings.Trim(p, "/"))
+		if !ok {
+			return nil, fmt.Errorf("failed to parse path")
+		}
+		return dataPath, nil
+	}
+
+	if p != ast.DefaultRootDocument.Value.String() && !strings.HasPrefix(p, "data.") {
+		p = "data." + p
+	}
+
+	ref, err := ast.ParseRef(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.NewPathForRef(ref)
+}
+
+// lookup finds the document at the path
+func lookup(data map[string]interface{}, p storage.Path) (interface{}, bool) {
+	var doc interface{} = data
+	for _, key := range p {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if doc, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
@@ -0,0 +1,81 @@
+package store_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+)
+
+const usersSchema = `{
+	"type": "object",
+	"properties": {
+		"admins": {
+			"type": "array",
+			"items": {"type": "string"}
+		}
+	},
+	"required": ["admins"]
+}`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		path   string
+		errors []string
+	}{
+		{name: "valid", data: `{"admins": ["alice"]}`, path: "users"},
+		{name: "valid ref", data: `{"admins": ["alice"]}`, path: "data.users"},
+		{name: "valid slash path", data: `{"admins": ["alice"]}`, path: "/users/"},
+		{name: "invalid", data: `{"admins": ["alice", 1]}`, path: "users", errors: []string{"admins.1", "string"}},
+		{name: "missing required", data: `{}`, path: "users", errors: []string{"admins is required"}},
+		{name: "missing document", data: `{"admins": []}`, path: "groups", errors: []string{"document not found"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildBundle(map[string]string{
+				"authz/policy.rego": "package authz",
+				"users/data.json":   tt.data,
+			}, &store.BuildOptions{
+				Schemas: map[string][]byte{tt.path: []byte(usersSchema)},
+			})
+
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Errorf("expected the document to be valid, got %s", err)
+				}
+				return
+			}
+
+			var schemaErr *store.SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("expected a schema error to fail the build, got %v", err)
+			}
+
+			if schemaErr.Path != tt.path {
+				t.Errorf("expected the error for path %s, got %s", tt.path, schemaErr.Path)
+			}
+
+			for _, msg := range tt.errors {
+				if !strings.Contains(err.Error(), msg) {
+					t.Errorf("expected the error to contain %q, got %s", msg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSchema(t *testing.T) {
+	_, err := buildBundle(map[string]string{
+		"users/data.json": `{"admins": []}`,
+	}, &store.BuildOptions{
+		Schemas: map[string][]byte{"users": []byte(`{"type": 1}`)},
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "invalid schema for users") {
+		t.Errorf("expected an invalid schema error, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+// Sign generates the bundle's .signatures.json. The signature is compatible
+// with the OPA bundle verification config, files matching an exclude pattern
+// are left out of the signature and should be listed in the verification
+// config's exclude_files
+func Sign(b *bundle.Bundle, opts *SigningOptions) error {
+	sc := bundle.NewSigningConfig(opts.Key, opts.Algorithm, opts.ClaimsFile)
+
+	// load the key first to provide a clear error
+	if _, err := sc.GetPrivateKey(); err != nil {
+		return fmt.Errorf("failed to load %s signing key: %s", sc.Algorithm, err)
+	}
+
+	hash, err := bundle.NewSignatureHasher(bundle.SHA256)
+	if err != nil {
+		return err
+	}
+
+	files := []bundle.FileInfo{}
+	add := func(path string, content interface{}) error {
+		path = strings.TrimPrefix(path, "/")
+		for _, pattern := range opts.Exclude {
+			if match, _ := filepath.Match(pattern, path); match {
+				return nil
+			}
+		}
+
+		bs, err := hash.HashFile(content)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, bundle.NewFile(path, hex.EncodeToString(bs), string(bundle.SHA256)))
+		return nil
+	}
+
+	for _, module := range b.Modules {
+		if err := add(module.URL, module.Raw); err != nil {
+			return err
+		}
+	}
+
+	if err := add("data.json", b.Data); err != nil {
+		return err
+	}
+
+	if len(b.Wasm) != 0 {
+		if err := add(bundle.WasmFile, b.Wasm); err != nil {
+			return err
+		}
+	}
+
+	for _, module := range b.WasmModules {
+		if err := add(module.URL, module.Raw); err != nil {
+			return err
+		}
+	}
+
+	// the bundle writer skips empty manifests
+	if !b.Manifest.Equal(bundle.Manifest{}) {
+		if err := add(bundle.ManifestExt, b.Manifest); err != nil {
+			return err
+		}
+	}
+
+	token, err := bundle.GenerateSignedToken(files, sc, opts.KeyID)
+	if err != nil {
+		return fmt.Errorf("failed to sign bundle: %s", err)
+	}
+
+	b.Signatures = bundle.SignaturesConfig{
+		Signatures: []string{token},
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+// buildBundle builds a bundle from the files with the build options
+func buildBundle(files map[string]string, opts *store.BuildOptions) ([]byte, error) {
+	list := store.EntryList{}
+	for key, value := range files {
+		list = append(list, &store.Entry{Key: key, Value: []byte(value)})
+	}
+
+	archive, err := store.Archive(context.Background(), list)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := bundle.NewTarballLoaderWithBaseURL(bytes.NewReader(archive), "")
+	return store.Bundle(context.Background(), loader, opts)
+}
+
+func rsaKeys(t *testing.T) (private, public string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %s", err)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %s", err)
+	}
+
+	private = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	public = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	return
+}
+
+func TestSign(t *testing.T) {
+	files := map[string]string{
+		"authz/policy.rego":  "package authz\n\nallow { data.users[input.user] }",
+		"users/data.json":    `{"alice": true}`,
+		"authz/extra/x.rego": "package authz.extra\n\nx = 1",
+	}
+
+	private, public := rsaKeys(t)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		sign      string
+		verify    string
+		exclude   []string
+		skip      []string
+		err       string
+	}{
+		{name: "rs256", algorithm: "RS256", sign: private, verify: public},
+		{name: "hs256", algorithm: "HS256", sign: "secret", verify: "secret"},
+		{name: "wrong secret", algorithm: "HS256", sign: "secret", verify: "other", err: "signature"},
+		{name: "excludes", algorithm: "HS256", sign: "secret", verify: "secret", exclude: []string{"data.json"}, skip: []string{"data.json"}},
+		{name: "excluded file not skipped", algorithm: "HS256", sign: "secret", verify: "secret", exclude: []string{"data.json"}, err: "data.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := buildBundle(files, &store.BuildOptions{
+				Signing: &store.SigningOptions{
+					KeyID:     "signer",
+					Algorithm: tt.algorithm,
+					Key:       tt.sign,
+					Exclude:   tt.exclude,
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to build bundle: %s", err)
+			}
+
+			config := bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{
+				"signer": {Key: tt.verify, Algorithm: tt.algorithm},
+			}, "signer", "", tt.skip)
+
+			_, err = bundle.NewReader(bytes.NewReader(data)).
+				WithBundleVerificationConfig(config).
+				Read()
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("expected the bundle to be verified, got %s", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("expected verification to fail")
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("expected an error containing %q, got %s", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSignInvalidKey(t *testing.T) {
+	_, err := buildBundle(map[string]string{"authz/policy.rego": "package authz"}, &store.BuildOptions{
+		Signing: &store.SigningOptions{
+			Algorithm: "RS256",
+			Key:       "not a key",
+		},
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "failed to load RS256 signing key") {
+		t.Errorf("expected the key load error to fail the build, got %v", err)
+	}
+}
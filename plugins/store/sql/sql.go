@@ -0,0 +1,310 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/bundle"
+
+	// supported drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	ProviderName           = "sql"
+	DriverPostgres         = "postgres"
+	DriverSQLite           = "sqlite3"
+	DefaultTable           = "bundle_files"
+	DefaultPathColumn      = "path"
+	DefaultContentColumn   = "content"
+	DefaultUpdatedAtColumn = "updated_at"
+)
+
+var (
+	driverAliases = map[string]string{
+		"postgres":   DriverPostgres,
+		"postgresql": DriverPostgres,
+		"sqlite":     DriverSQLite,
+		"sqlite3":    DriverSQLite,
+	}
+)
+
+func init() {
+	store.Providers[ProviderName] = NewStore
+}
+
+type Store struct {
+	mx     sync.RWMutex
+	name   string
+	config *Config
+	logger logger.Logger
+	db     *sql.DB
+}
+
+// Config configures the rows read into the bundle. Each row is a bundle
+// file with a path like authz/policy.rego or users/data.json. When a
+// query is set it must select the path, content and updated_at columns
+type Config struct {
+	Driver          string `json:"driver" yaml:"driver"`
+	DSN             string `json:"dsn" yaml:"dsn"`
+	DSNEnv          string `json:"dsn_env" yaml:"dsn_env"`
+	Table           string `json:"table" yaml:"table"`
+	Query           string `json:"query" yaml:"query"`
+	PathColumn      string `json:"path_column" yaml:"path_column"`
+	ContentColumn   string `json:"content_column" yaml:"content_column"`
+	UpdatedAtColumn string `json:"updated_at_column" yaml:"updated_at_column"`
+}
+
+// NewStore creates a new store
+func NewStore(opts *store.Options) (store.Store, error) {
+	s := &Store{
+		name:   opts.Name,
+		config: &Config{},
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for store %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	driver, ok := driverAliases[s.config.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver %q for sql store %s", s.config.Driver, opts.Name)
+	}
+	s.config.Driver = driver
+
+	if s.config.DSN == "" && s.config.DSNEnv == "" {
+		return nil, fmt.Errorf("no dsn provided for sql store %s", opts.Name)
+	}
+
+	if s.config.Table == "" {
+		s.config.Table = DefaultTable
+	}
+
+	if s.config.PathColumn == "" {
+		s.config.PathColumn = DefaultPathColumn
+	}
+
+	if s.config.ContentColumn == "" {
+		s.config.ContentColumn = DefaultContentColumn
+	}
+
+	if s.config.UpdatedAtColumn == "" {
+		s.config.UpdatedAtColumn = DefaultUpdatedAtColumn
+	}
+
+	return s, nil
+}
+
+// Connect opens the database and verifies the connection
+func (s *Store) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to %s sql store %s", s.config.Driver, s.name)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.db != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	dsn := s.config.DSN
+	if s.config.DSNEnv != "" {
+		if dsn = os.Getenv(s.config.DSNEnv); dsn == "" {
+			return fmt.Errorf("dsn environment variable %s is not set", s.config.DSNEnv)
+		}
+	}
+
+	db, err := sql.Open(s.config.Driver, dsn)
+	if err != nil {
+		return
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return
+	}
+
+	s.db = db
+	return
+}
+
+// Disconnect closes the database
+func (s *Store) Disconnect(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.db == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	err = s.db.Close()
+	s.db = nil
+	return
+}
+
+// Revision returns the latest updated_at and the row count so
+// that deleted rows are detected as a change
+func (s *Store) Revision(ctx context.Context) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.db == nil {
+		return "", fmt.Errorf("sql store %s is not connected", s.name)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT MAX(%s), COUNT(*) FROM %s",
+		s.config.UpdatedAtColumn,
+		s.source(),
+	)
+
+	var (
+		updatedAt interface{}
+		count     int64
+	)
+
+	if err := s.db.QueryRowContext(ctx, query).Scan(&updatedAt, &count); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%d", formatRevision(updatedAt), count), nil
+}
+
+// Bundle reads the rows and builds the bundle. The latest
+// updated_at is used as the bundle revision
+func (s *Store) Bundle(ctx context.Context, opts *store.BuildOptions) ([]byte, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.db == nil {
+		return nil, fmt.Errorf("sql store %s is not connected", s.name)
+	}
+
+	query := s.config.Query
+	if query == "" {
+		query = fmt.Sprintf(
+			"SELECT %s, %s, %s FROM %s",
+			s.config.PathColumn,
+			s.config.ContentColumn,
+			s.config.UpdatedAtColumn,
+			s.config.Table,
+		)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		s.logger.Error("failed to query sql store %s: %s", s.name, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var latest interface{}
+
+	list := store.EntryList{}
+	for rows.Next() {
+		var (
+			p         string
+			content   []byte
+			updatedAt interface{}
+		)
+
+		if err := rows.Scan(&p, &content, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		if later(updatedAt, latest) {
+			latest = updatedAt
+		}
+
+		list = append(list, &store.Entry{
+			Key:   store.NormalizePath(p),
+			Value: content,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("read %d rows from sql store %s updated at %v", len(list), s.name, latest)
+
+	archive, err := store.Archive(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := bundle.NewTarballLoaderWithBaseURL(
+		bytes.NewReader(archive),
+		"",
+	)
+
+	return store.Bundle(ctx, loader, opts.WithSourceRevision(formatRevision(latest)))
+}
+
+// source is the table or query the revision is selected from
+func (s *Store) source() string {
+	if s.config.Query == "" {
+		return s.config.Table
+	}
+
+	return fmt.Sprintf("(%s) AS bundle_files", s.config.Query)
+}
+
+// later returns true if the updated_at value a is later than b. Values
+// are compared by their type the same way MAX(updated_at) compares them
+func later(a, b interface{}) bool {
+	switch value := a.(type) {
+	case nil:
+		return false
+	case time.Time:
+		if prev, ok := b.(time.Time); ok {
+			return value.After(prev)
+		}
+	case int64:
+		if prev, ok := b.(int64); ok {
+			return value > prev
+		}
+	case float64:
+		if prev, ok := b.(float64); ok {
+			return value > prev
+		}
+	}
+
+	if b == nil {
+		return true
+	}
+
+	return formatRevision(a) > formatRevision(b)
+}
+
+// formatRevision formats an updated_at value as a revision
+func formatRevision(v interface{}) string {
+	switch value := v.(type) {
+	case time.Time:
+		return value.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
@@ -0,0 +1,167 @@
+package sql_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	storesql "github.com/bhoriuchi/opa-bundle-server/plugins/store/sql"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+const schema = `
+CREATE TABLE bundle_files (
+	path TEXT PRIMARY KEY,
+	content TEXT,
+	updated_at DATETIME,
+	bundle TEXT
+);
+INSERT INTO bundle_files VALUES ('authz/policy.rego', 'package authz
+
+allow { data.users[input.user] }', '2021-10-17 10:00:00', 'authz');
+INSERT INTO bundle_files VALUES ('users/data.json', '{"alice": true}', '2021-10-17 11:00:00', 'authz');
+INSERT INTO bundle_files VALUES ('other/policy.rego', 'package other', '2021-10-17 12:00:00', 'other');
+`
+
+func setup(t *testing.T, config storesql.Config) (store.Store, *sql.DB) {
+	dsn := filepath.Join(t.TempDir(), "bundles.db")
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("failed to create schema: %s", err)
+	}
+
+	config.Driver = "sqlite"
+	config.DSN = dsn
+	s, err := storesql.NewStore(&store.Options{
+		Name:   "test",
+		Config: config,
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create sql store: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect sql store: %s", err)
+	}
+
+	return s, db
+}
+
+func readBundle(t *testing.T, s store.Store) bundle.Bundle {
+	data, err := s.Bundle(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %s", err)
+	}
+
+	b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		t.Fatalf("failed to read bundle: %s", err)
+	}
+
+	return b
+}
+
+func revision(t *testing.T, s store.Store) string {
+	r, err := s.(store.Revisioner).Revision(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+	return r
+}
+
+func TestTable(t *testing.T) {
+	s, db := setup(t, storesql.Config{})
+	defer db.Close()
+	defer s.Disconnect(context.Background())
+
+	b := readBundle(t, s)
+	if len(b.Modules) != 2 {
+		t.Errorf("expected 2 modules, got %d", len(b.Modules))
+	}
+
+	if _, ok := b.Data["users"]; !ok {
+		t.Errorf("expected users data in the bundle, got %v", b.Data)
+	}
+
+	if b.Manifest.Revision != "2021-10-17T12:00:00.000000000Z" {
+		t.Errorf("expected the latest updated_at as the revision, got %s", b.Manifest.Revision)
+	}
+
+	before := revision(t, s)
+	if _, err := db.Exec(`DELETE FROM bundle_files WHERE path = 'users/data.json'`); err != nil {
+		t.Fatalf("failed to delete row: %s", err)
+	}
+
+	if after := revision(t, s); before == after {
+		t.Errorf("expected the revision to change when a row is deleted")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	s, db := setup(t, storesql.Config{
+		Query: `SELECT path, content, updated_at FROM bundle_files WHERE bundle = 'authz'`,
+	})
+	defer db.Close()
+	defer s.Disconnect(context.Background())
+
+	b := readBundle(t, s)
+	if len(b.Modules) != 1 {
+		t.Errorf("expected 1 module, got %d", len(b.Modules))
+	}
+
+	if b.Manifest.Revision != "2021-10-17T11:00:00.000000000Z" {
+		t.Errorf("expected the latest updated_at of the query as the revision, got %s", b.Manifest.Revision)
+	}
+
+	if r := revision(t, s); r != "2021-10-17 11:00:00/2" {
+		t.Errorf("unexpected revision %s", r)
+	}
+}
+
+func TestDisconnected(t *testing.T) {
+	s, db := setup(t, storesql.Config{})
+	defer db.Close()
+
+	if err := s.Disconnect(context.Background()); err != nil {
+		t.Fatalf("failed to disconnect: %s", err)
+	}
+
+	if _, err := s.Bundle(context.Background(), nil); err == nil {
+		t.Errorf("expected an error building a disconnected store")
+	}
+
+	if _, err := s.(store.Revisioner).Revision(context.Background()); err == nil {
+		t.Errorf("expected an error getting the revision of a disconnected store")
+	}
+}
+
+func TestNumericRevision(t *testing.T) {
+	s, db := setup(t, storesql.Config{Table: "versioned_files", UpdatedAtColumn: "version"})
+	defer db.Close()
+	defer s.Disconnect(context.Background())
+
+	if _, err := db.Exec(`
+CREATE TABLE versioned_files (path TEXT PRIMARY KEY, content TEXT, version INTEGER);
+INSERT INTO versioned_files VALUES ('a/policy.rego', 'package a', 9);
+INSERT INTO versioned_files VALUES ('b/policy.rego', 'package b', 10);
+`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	if b := readBundle(t, s); b.Manifest.Revision != "10" {
+		t.Errorf("expected the largest version as the revision, got %s", b.Manifest.Revision)
+	}
+
+	if r := revision(t, s); r != "10/2" {
+		t.Errorf("unexpected revision %s", r)
+	}
+}
@@ -28,9 +28,10 @@ var (
 type NewStoreFunc func(opts *Options) (Store, error)
 
 type Options struct {
-	Name   string
-	Config interface{}
-	Logger logger.Logger
+	Name     string
+	Config   interface{}
+	Logger   logger.Logger
+	Callback func()
 }
 
 type EntryList []*Entry
@@ -84,7 +85,54 @@ type Manifest struct {
 type Store interface {
 	Connect(ctx context.Context) (err error)
 	Disconnect(ctx context.Context) (err error)
-	Bundle(ctx context.Context) ([]byte, error)
+	Bundle(ctx context.Context, opts *BuildOptions) ([]byte, error)
+}
+
+// Revisioner is implemented by stores that can cheaply report the revision
+// of their contents. Polling skips the build when the revision is unchanged
+type Revisioner interface {
+	Revision(ctx context.Context) (string, error)
+}
+
+// BuildOptions are the bundle specific options used when a store builds
+// a bundle. This allows the same store to be built differently for
+// each bundle that uses it
+type BuildOptions struct {
+	Target            string
+	OptimizationLevel int
+	Entrypoints       []string
+	Capabilities      *ast.Capabilities
+	PruneUnused       bool
+	Revision          string
+	Roots             []string
+	SourceRevision    string
+	Schemas           map[string][]byte
+	Test              *TestOptions
+	Signing           *SigningOptions
+}
+
+// WithSourceRevision returns a copy of the options with the revision of
+// the store contents the bundle is built from. A revision set in the
+// options takes precedence over the source revision
+func (o *BuildOptions) WithSourceRevision(revision string) *BuildOptions {
+	opts := &BuildOptions{}
+	if o != nil {
+		*opts = *o
+	}
+
+	opts.SourceRevision = revision
+	return opts
+}
+
+// SigningOptions are used to sign the bundle. Key is the PEM encoded
+// private key or the secret for HMAC algorithms. Files matching an
+// exclude pattern are left out of the signature
+type SigningOptions struct {
+	KeyID      string
+	Algorithm  string
+	Key        string
+	ClaimsFile string
+	Exclude    []string
 }
 
 type Err struct {
@@ -167,7 +215,11 @@ func Archive(ctx context.Context, entries EntryList) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func Bundle(ctx context.Context, loader bundle.DirectoryLoader) ([]byte, error) {
+func Bundle(ctx context.Context, loader bundle.DirectoryLoader, opts *BuildOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &BuildOptions{}
+	}
+
 	reader := bundle.NewCustomReader(loader)
 
 	b, err := reader.Read()
@@ -175,14 +227,76 @@ func Bundle(ctx context.Context, loader bundle.DirectoryLoader) ([]byte, error)
 		return nil, err
 	}
 
-	// TODO: support all compile options from config file
-	buf := bytes.NewBuffer([]byte{})
+	capabilities := opts.Capabilities
+	if capabilities == nil {
+		capabilities = ast.CapabilitiesForThisVersion()
+	}
+
+	// validate the data documents before they are served
+	if len(opts.Schemas) > 0 {
+		if err := Validate(&b, opts.Schemas); err != nil {
+			return nil, err
+		}
+	}
+
+	// run the tests before anything is removed from the bundle
+	if opts.Test != nil {
+		if err := Test(ctx, &b, capabilities, opts.Test); err != nil {
+			return nil, err
+		}
+	}
+
+	// override the roots claimed by the bundle
+	if opts.Roots != nil {
+		roots := append([]string{}, opts.Roots...)
+		b.Manifest.Roots = &roots
+	}
+
+	if opts.PruneUnused {
+		if err := Prune(&b, capabilities, opts.Entrypoints); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Target == compile.TargetWasm {
+		if err := ValidateWasm(&b, capabilities, opts.Entrypoints); err != nil {
+			return nil, err
+		}
+	}
+
 	compiler := compile.New().
-		WithCapabilities(ast.CapabilitiesForThisVersion()).
-		WithOutput(buf).
+		WithCapabilities(capabilities).
+		WithOptimizationLevel(opts.OptimizationLevel).
+		WithEntrypoints(opts.Entrypoints...).
 		WithBundle(&b)
 
+	if opts.Target != "" {
+		compiler = compiler.WithTarget(opts.Target)
+	}
+
+	switch {
+	case opts.Revision != "":
+		compiler = compiler.WithRevision(opts.Revision)
+	case opts.SourceRevision != "":
+		compiler = compiler.WithRevision(opts.SourceRevision)
+	}
+
 	if err := compiler.Build(ctx); err != nil {
+		if opts.Target == compile.TargetWasm {
+			return nil, WasmError(err)
+		}
+		return nil, err
+	}
+
+	result := compiler.Bundle()
+	if opts.Signing != nil {
+		if err := Sign(result, opts.Signing); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := bundle.NewWriter(buf).Write(*result); err != nil {
 		return nil, err
 	}
 
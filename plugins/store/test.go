@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/cover"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/tester"
+)
+
+const (
+	TestFileSuffix = "_test.rego"
+)
+
+// TestOptions gate the bundle on the rego unit tests it contains. The
+// coverage threshold is a percentage of the non-test modules
+type TestOptions struct {
+	CoverageThreshold float64
+}
+
+// TestError is returned when the bundle tests fail or the
+// coverage is below the threshold
+type TestError struct {
+	Failed    []string
+	Coverage  float64
+	Threshold float64
+}
+
+func (e *TestError) Error() string {
+	msgs := []string{}
+	if len(e.Failed) > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d test(s) failed: %s", len(e.Failed), strings.Join(e.Failed, ", ")))
+	}
+
+	if e.Coverage < e.Threshold {
+		msgs = append(msgs, fmt.Sprintf("coverage %.2f%% is below the threshold of %.2f%%", e.Coverage, e.Threshold))
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// IsTestFile returns true if the file is a rego test file
+func IsTestFile(path string) bool {
+	return strings.HasSuffix(path, TestFileSuffix)
+}
+
+// Test runs the rego unit tests in the bundle against the bundle data
+// and removes the test files from the bundle once they pass
+func Test(ctx context.Context, b *bundle.Bundle, capabilities *ast.Capabilities, opts *TestOptions) error {
+	modules := map[string]*ast.Module{}
+	policies := map[string]*ast.Module{}
+	for _, module := range b.Modules {
+		modules[module.Path] = module.Parsed
+		if !IsTestFile(module.Path) {
+			policies[module.Path] = module.Parsed
+		}
+	}
+
+	data := b.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	st := inmem.NewFromObject(data)
+	txn, err := st.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer st.Abort(ctx, txn)
+
+	coverage := cover.New()
+	runner := tester.NewRunner().
+		SetCompiler(ast.NewCompiler().WithCapabilities(capabilities)).
+		SetStore(st).
+		SetModules(modules).
+		SetCoverageQueryTracer(coverage)
+
+	ch, err := runner.RunTests(ctx, txn)
+	if err != nil {
+		return fmt.Errorf("failed to run tests: %s", err)
+	}
+
+	testErr := &TestError{
+		Failed:    []string{},
+		Threshold: opts.CoverageThreshold,
+	}
+
+	for result := range ch {
+		if result.Skip || result.Pass() {
+			continue
+		}
+
+		name := fmt.Sprintf("%s.%s", result.Package, result.Name)
+		if result.Error != nil {
+			name = fmt.Sprintf("%s (%s)", name, result.Error)
+		}
+		testErr.Failed = append(testErr.Failed, name)
+	}
+
+	if opts.CoverageThreshold > 0 {
+		testErr.Coverage = coverage.Report(policies).Coverage
+	}
+
+	if len(testErr.Failed) > 0 || testErr.Coverage < testErr.Threshold {
+		return testErr
+	}
+
+	// strip the tests from the bundle
+	stripped := []bundle.ModuleFile{}
+	for _, module := range b.Modules {
+		if !IsTestFile(module.Path) {
+			stripped = append(stripped, module)
+		}
+	}
+	b.Modules = stripped
+
+	return nil
+}
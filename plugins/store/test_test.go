@@ -0,0 +1,114 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+const (
+	testPolicy = `package authz
+
+allow {
+	data.users[input.user]
+}
+
+deny {
+	not allow
+}`
+
+	testUsers = `{"alice": true}`
+)
+
+func TestTestGate(t *testing.T) {
+	tests := []struct {
+		name      string
+		tests     string
+		threshold float64
+		failed    []string
+		coverage  bool
+	}{
+		{
+			name: "passing",
+			tests: `package authz
+
+test_allow {
+	allow with input as {"user": "alice"}
+}`,
+		},
+		{
+			name: "failing",
+			tests: `package authz
+
+test_allow {
+	allow with input as {"user": "alice"}
+}
+
+test_allow_bob {
+	allow with input as {"user": "bob"}
+}`,
+			failed: []string{"data.authz.test_allow_bob"},
+		},
+		{
+			name: "coverage below the threshold",
+			tests: `package authz
+
+test_allow {
+	allow with input as {"user": "alice"}
+}`,
+			threshold: 90,
+			coverage:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := buildBundle(map[string]string{
+				"authz/policy.rego":      testPolicy,
+				"authz/policy_test.rego": tt.tests,
+				"users/data.json":        testUsers,
+			}, &store.BuildOptions{
+				Test: &store.TestOptions{CoverageThreshold: tt.threshold},
+			})
+
+			if len(tt.failed) == 0 && !tt.coverage {
+				if err != nil {
+					t.Fatalf("expected the tests to pass, got %s", err)
+				}
+
+				b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+				if err != nil {
+					t.Fatalf("failed to read bundle: %s", err)
+				}
+
+				for _, module := range b.Modules {
+					if store.IsTestFile(module.Path) {
+						t.Errorf("expected test file %s to be stripped from the bundle", module.Path)
+					}
+				}
+
+				if len(b.Modules) != 1 {
+					t.Errorf("expected 1 module, got %d", len(b.Modules))
+				}
+				return
+			}
+
+			var testErr *store.TestError
+			if !errors.As(err, &testErr) {
+				t.Fatalf("expected a test error to fail the build, got %v", err)
+			}
+
+			if strings.Join(testErr.Failed, ",") != strings.Join(tt.failed, ",") {
+				t.Errorf("expected failed tests %v, got %v", tt.failed, testErr.Failed)
+			}
+
+			if tt.coverage && testErr.Coverage >= tt.threshold {
+				t.Errorf("expected coverage below %.2f%%, got %.2f%%", tt.threshold, testErr.Coverage)
+			}
+		})
+	}
+}
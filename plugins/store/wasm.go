@@ -0,0 +1,69 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+// ValidateWasm checks that the bundle can be compiled to the wasm target.
+// Every entrypoint must exist and only builtins in the capabilities can
+// be used. Builtins not implemented natively by the wasm compiler are
+// imported from the host, so restricting the capabilities to the builtins
+// supported by the wasm SDK running the policy catches unsupported
+// builtins at build time
+func ValidateWasm(b *bundle.Bundle, capabilities *ast.Capabilities, entrypoints []string) error {
+	if len(entrypoints) == 0 {
+		return fmt.Errorf("the wasm target requires at least one entrypoint")
+	}
+
+	compiler, err := compileModules(b, capabilities)
+	if err != nil {
+		return WasmError(err)
+	}
+
+	missing := []string{}
+	for _, entrypoint := range entrypoints {
+		rules, err := entrypointRules(compiler, entrypoint)
+		if err != nil {
+			return err
+		}
+
+		if len(rules) == 0 {
+			missing = append(missing, entrypoint)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("wasm entrypoint(s) %s not found in bundle", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// WasmError describes builtins that are not supported for the wasm target
+func WasmError(err error) error {
+	errs, ok := err.(ast.Errors)
+	if !ok {
+		return fmt.Errorf("wasm compilation failed: %s", err)
+	}
+
+	unsupported := []string{}
+	for _, e := range errs {
+		if e.Code == ast.TypeErr && strings.HasPrefix(e.Message, "undefined function ") {
+			location := ""
+			if e.Location != nil {
+				location = fmt.Sprintf(" (%s)", e.Location)
+			}
+			unsupported = append(unsupported, strings.TrimPrefix(e.Message, "undefined function ")+location)
+		}
+	}
+
+	if len(unsupported) == 0 {
+		return fmt.Errorf("wasm compilation failed: %s", err)
+	}
+
+	return fmt.Errorf("wasm compilation failed, unsupported builtin(s): %s", strings.Join(unsupported, ", "))
+}
@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/store"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+func TestValidateWasm(t *testing.T) {
+	withoutUpper := &ast.Capabilities{}
+	for _, builtin := range ast.CapabilitiesForThisVersion().Builtins {
+		if builtin.Name != ast.Upper.Name {
+			withoutUpper.Builtins = append(withoutUpper.Builtins, builtin)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		policy       string
+		capabilities *ast.Capabilities
+		entrypoints  []string
+		err          string
+	}{
+		{
+			name:        "supported builtins",
+			policy:      "package authz\n\nallow { count(input.roles) > 0; upper(input.user) == \"ALICE\" }",
+			entrypoints: []string{"authz/allow"},
+		},
+		{
+			name:        "host builtins",
+			policy:      "package authz\n\nallow { time.now_ns() > 0; sprintf(\"%s\", [input.user]) == \"alice\" }",
+			entrypoints: []string{"authz/allow"},
+		},
+		{
+			name:         "builtin missing from capabilities",
+			policy:       "package authz\n\nallow { upper(input.user) == \"ALICE\" }",
+			capabilities: withoutUpper,
+			entrypoints:  []string{"authz/allow"},
+			err:          "unsupported builtin(s): upper",
+		},
+		{
+			name:        "missing entrypoint",
+			policy:      "package authz\n\nallow = true",
+			entrypoints: []string{"authz/deny"},
+			err:         "wasm entrypoint(s) authz/deny not found",
+		},
+		{
+			name:   "no entrypoints",
+			policy: "package authz\n\nallow = true",
+			err:    "requires at least one entrypoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capabilities := tt.capabilities
+			if capabilities == nil {
+				capabilities = ast.CapabilitiesForThisVersion()
+			}
+
+			b := parseBundle(t, map[string]string{"authz/policy.rego": tt.policy})
+			err := store.ValidateWasm(b, capabilities, tt.entrypoints)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("expected no error, got %s", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("expected an error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("expected an error containing %q, got %s", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestBundleWasmHostBuiltins(t *testing.T) {
+	data, err := buildBundle(map[string]string{
+		"authz/policy.rego": "package authz\n\nallow { time.now_ns() > 0 }\n\nmsg = sprintf(\"hello %s\", [input.user])",
+	}, &store.BuildOptions{
+		Target:      "wasm",
+		Entrypoints: []string{"authz/allow", "authz/msg"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build wasm bundle: %s", err)
+	}
+
+	b, err := bundle.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		t.Fatalf("failed to read bundle: %s", err)
+	}
+
+	if len(b.WasmModules) != 1 {
+		t.Errorf("expected the bundle to contain a wasm module, got %d", len(b.WasmModules))
+	}
+}
@@ -0,0 +1,196 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bep/debounce"
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/open-policy-agent/opa/util"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	ProviderName    = "etcd"
+	DefaultDebounce = "200ms"
+	maxRetryDelay   = 30 * time.Second
+)
+
+func init() {
+	subscriber.Providers[ProviderName] = NewSubscriber
+}
+
+type Subscriber struct {
+	name     string
+	cb       func()
+	client   *etcd.Client
+	config   *Config
+	logger   logger.Logger
+	debounce func(f func())
+	cancel   context.CancelFunc
+}
+
+type Config struct {
+	WatchType string       `json:"watch_type" yaml:"watch_type"`
+	Topic     string       `json:"topic" yaml:"topic"`
+	Debounce  string       `json:"debounce" yaml:"debounce"`
+	Etcd      *etcd.Config `json:"etcd" yaml:"etcd"`
+}
+
+// NewSubscriber creates a new subscriber
+func NewSubscriber(opts *subscriber.Options) (subscriber.Subscriber, error) {
+	s := &Subscriber{
+		name:   opts.Name,
+		config: &Config{},
+		cb:     opts.Callback,
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for subscriber %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.Debounce == "" {
+		s.config.Debounce = DefaultDebounce
+	}
+
+	duration, err := time.ParseDuration(s.config.Debounce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debounce duration for etcd subscriber %s: %s", s.name, err)
+	}
+
+	s.debounce = debounce.New(duration)
+
+	if s.config.Etcd == nil {
+		return nil, fmt.Errorf("no etcd configuration provided for subscriber %s", opts.Name)
+	}
+
+	if s.config.Topic == "" {
+		return nil, fmt.Errorf("no topic specified for etcd subscriber %s", s.name)
+	}
+
+	switch s.config.WatchType {
+	case "key", "prefix":
+	case "":
+		s.config.WatchType = "prefix"
+	default:
+		return nil, fmt.Errorf("unsupported watch type %q for etcd subscriber %s", s.config.WatchType, s.name)
+	}
+
+	return s, nil
+}
+
+func (s *Subscriber) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to etcd watcher %s at %v", s.name, s.config.Etcd.Endpoints)
+	if s.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	s.client, err = etcd.NewClient(s.config.Etcd)
+	return
+}
+
+func (s *Subscriber) Disconnect(ctx context.Context) (err error) {
+	if s.client == nil {
+		err = fmt.Errorf("not connected")
+		return
+	}
+
+	s.Unsubscribe(ctx)
+	err = s.client.Close()
+	s.client = nil
+	return
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context) (err error) {
+	if s.cancel != nil {
+		err = fmt.Errorf("etcd watcher already started on subscriber %s", s.name)
+		return
+	}
+
+	if s.client == nil {
+		err = fmt.Errorf("etcd subscriber %s is not connected", s.name)
+		return
+	}
+
+	var watchCtx context.Context
+	watchCtx, s.cancel = context.WithCancel(context.Background())
+	go s.watch(watchCtx, s.client)
+
+	return
+}
+
+func (s *Subscriber) Unsubscribe(ctx context.Context) (err error) {
+	if s.cancel == nil {
+		err = fmt.Errorf("etcd watcher on subscriber %s is already stopped", s.name)
+		return
+	}
+
+	s.cancel()
+	s.cancel = nil
+	return
+}
+
+// watch watches the topic until the context is canceled. The watch is
+// resumed from the last revision with a backoff if it fails
+func (s *Subscriber) watch(ctx context.Context, client *etcd.Client) {
+	var (
+		retry    int
+		revision int64
+	)
+
+	s.logger.Debug("etcd subscriber %s is watching %s %s", s.name, s.config.WatchType, s.config.Topic)
+
+	for {
+		opts := []clientv3.OpOption{}
+		if s.config.WatchType == "prefix" {
+			opts = append(opts, clientv3.WithPrefix())
+		}
+		if revision > 0 {
+			opts = append(opts, clientv3.WithRev(revision+1))
+		}
+
+		watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		wc := client.Etcd().Watch(watchCtx, s.config.Topic, opts...)
+		for resp := range wc {
+			if resp.CompactRevision != 0 {
+				// the revision was compacted so changes may have been missed
+				s.logger.Warn("etcd watcher on subscriber %s revision %d was compacted", s.name, revision)
+				revision = 0
+				s.debounce(s.cb)
+				break
+			}
+
+			if err := resp.Err(); err != nil {
+				s.logger.Error("etcd watcher on subscriber %s failed: %s", s.name, err)
+				break
+			}
+
+			retry = 0
+			revision = resp.Header.Revision
+			if len(resp.Events) > 0 {
+				s.logger.Debug("etcd subscriber %s received a message", s.name)
+				s.debounce(s.cb)
+			}
+		}
+		cancel()
+
+		delay := util.DefaultBackoff(float64(time.Second), float64(maxRetryDelay), retry)
+		retry++
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+			s.logger.Debug("restarting etcd watcher on subscriber %s", s.name)
+		}
+	}
+}
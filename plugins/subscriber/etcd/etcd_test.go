@@ -0,0 +1,75 @@
+package etcd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/etcd/etcdtest"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/etcd"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	config := etcdtest.Start(t)
+
+	client, err := config.Client()
+	if err != nil {
+		t.Fatalf("failed to create etcd client: %s", err)
+	}
+	defer client.Close()
+
+	called := make(chan struct{}, 1)
+	s, err := etcd.NewSubscriber(&subscriber.Options{
+		Name: "test",
+		Config: etcd.Config{
+			Topic:    "bundles/authz/",
+			Debounce: "10ms",
+			Etcd:     config,
+		},
+		Logger: logging.NewNoOpLogger(),
+		Callback: func() {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create etcd subscriber: %s", err)
+	}
+
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect etcd subscriber: %s", err)
+	}
+	defer s.Disconnect(ctx)
+
+	if err := s.Subscribe(ctx); err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+
+	// allow the watch to start
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := client.Put(ctx, "bundles/other/policy.rego", "package other"); err != nil {
+		t.Fatalf("failed to put key: %s", err)
+	}
+
+	select {
+	case <-called:
+		t.Fatal("expected changes outside the topic to be ignored")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if _, err := client.Put(ctx, "bundles/authz/policy.rego", "package authz"); err != nil {
+		t.Fatalf("failed to put key: %s", err)
+	}
+
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the callback to be called after a change")
+	}
+}
@@ -0,0 +1,228 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bep/debounce"
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/nats"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+const (
+	ProviderName         = "nats"
+	DefaultDebounce      = "200ms"
+	DefaultDeliverPolicy = "new"
+)
+
+var (
+	deliverPolicies = map[string]natsgo.DeliverPolicy{
+		"all":  natsgo.DeliverAllPolicy,
+		"last": natsgo.DeliverLastPolicy,
+		"new":  natsgo.DeliverNewPolicy,
+	}
+)
+
+func init() {
+	subscriber.Providers[ProviderName] = NewSubscriber
+}
+
+type Subscriber struct {
+	name     string
+	cb       func()
+	client   *nats.Client
+	sub      *natsgo.Subscription
+	config   *Config
+	logger   logger.Logger
+	debounce func(f func())
+}
+
+// Config configures the subscription. When jetstream is set the
+// topic is consumed from a stream with a durable consumer
+type Config struct {
+	Topic     string           `json:"topic" yaml:"topic"`
+	Debounce  string           `json:"debounce" yaml:"debounce"`
+	JetStream *JetStreamConfig `json:"jetstream" yaml:"jetstream"`
+	NATS      *nats.Config     `json:"nats" yaml:"nats"`
+}
+
+// JetStreamConfig configures the durable consumer. The durable name
+// must be unique to each server since a consumer is bound to a single
+// subscription. The deliver policy only applies to new consumers
+type JetStreamConfig struct {
+	Stream        string `json:"stream" yaml:"stream"`
+	Durable       string `json:"durable" yaml:"durable"`
+	DeliverPolicy string `json:"deliver_policy" yaml:"deliver_policy"`
+}
+
+// NewSubscriber creates a new subscriber
+func NewSubscriber(opts *subscriber.Options) (subscriber.Subscriber, error) {
+	s := &Subscriber{
+		name:   opts.Name,
+		config: &Config{},
+		cb:     opts.Callback,
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for subscriber %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.Debounce == "" {
+		s.config.Debounce = DefaultDebounce
+	}
+
+	duration, err := time.ParseDuration(s.config.Debounce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debounce duration for nats subscriber %s: %s", s.name, err)
+	}
+
+	s.debounce = debounce.New(duration)
+
+	if s.config.NATS == nil {
+		return nil, fmt.Errorf("no nats configuration provided for subscriber %s", opts.Name)
+	}
+
+	if s.config.Topic == "" {
+		return nil, fmt.Errorf("no topic specified for nats subscriber %s", s.name)
+	}
+
+	if js := s.config.JetStream; js != nil {
+		if js.Stream == "" {
+			return nil, fmt.Errorf("no jetstream stream specified for nats subscriber %s", s.name)
+		}
+
+		if js.Durable == "" {
+			return nil, fmt.Errorf("no jetstream durable name specified for nats subscriber %s", s.name)
+		}
+
+		if js.DeliverPolicy == "" {
+			js.DeliverPolicy = DefaultDeliverPolicy
+		}
+
+		if _, ok := deliverPolicies[js.DeliverPolicy]; !ok {
+			return nil, fmt.Errorf("unsupported deliver policy %q for nats subscriber %s", js.DeliverPolicy, s.name)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Subscriber) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to nats subscriber %s", s.name)
+	if s.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	if s.client, err = nats.NewClient(s.config.NATS); err != nil {
+		return
+	}
+
+	s.client.NATS().SetDisconnectErrHandler(func(_ *natsgo.Conn, err error) {
+		if err != nil {
+			s.logger.Warn("nats subscriber %s disconnected: %s", s.name, err)
+		}
+	})
+
+	// core subjects do not persist messages so rebuild after
+	// reconnecting since messages may have been missed
+	s.client.NATS().SetReconnectHandler(func(_ *natsgo.Conn) {
+		s.logger.Info("nats subscriber %s reconnected", s.name)
+		if s.config.JetStream == nil {
+			s.debounce(s.cb)
+		}
+	})
+
+	return
+}
+
+func (s *Subscriber) Disconnect(ctx context.Context) (err error) {
+	if s.client == nil {
+		err = fmt.Errorf("not connected")
+		return
+	}
+
+	s.Unsubscribe(ctx)
+	err = s.client.Close()
+	s.client = nil
+	return
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context) (err error) {
+	if s.sub != nil {
+		err = fmt.Errorf("nats subscription already started on subscriber %s", s.name)
+		return
+	}
+
+	if s.config.JetStream != nil {
+		s.sub, err = s.subscribeJetStream()
+	} else {
+		s.sub, err = s.client.NATS().Subscribe(s.config.Topic, s.handle)
+	}
+
+	if err != nil {
+		return
+	}
+
+	s.logger.Debug("nats subscriber %s is subscribed to %s", s.name, s.config.Topic)
+	return
+}
+
+func (s *Subscriber) Unsubscribe(ctx context.Context) (err error) {
+	if s.sub == nil {
+		err = fmt.Errorf("nats subscription on subscriber %s is already stopped", s.name)
+		return
+	}
+
+	err = s.sub.Unsubscribe()
+	s.sub = nil
+	return
+}
+
+// subscribeJetStream subscribes with the durable consumer. The consumer
+// is created here rather than by the subscription so that it is not
+// deleted on unsubscribe and messages sent while the server is stopped
+// are delivered when it starts again
+func (s *Subscriber) subscribeJetStream() (*natsgo.Subscription, error) {
+	conf := s.config.JetStream
+
+	js, err := s.client.JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := js.ConsumerInfo(conf.Stream, conf.Durable); err == natsgo.ErrConsumerNotFound {
+		s.logger.Debug("creating jetstream consumer %s on stream %s", conf.Durable, conf.Stream)
+		if _, err := js.AddConsumer(conf.Stream, &natsgo.ConsumerConfig{
+			Durable:        conf.Durable,
+			DeliverSubject: natsgo.NewInbox(),
+			DeliverPolicy:  deliverPolicies[conf.DeliverPolicy],
+			AckPolicy:      natsgo.AckExplicitPolicy,
+			FilterSubject:  s.config.Topic,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create jetstream consumer %s: %s", conf.Durable, err)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return js.Subscribe(
+		s.config.Topic,
+		s.handle,
+		natsgo.Bind(conf.Stream, conf.Durable),
+	)
+}
+
+// handle triggers a rebuild when a message is received
+func (s *Subscriber) handle(msg *natsgo.Msg) {
+	s.logger.Debug("nats subscriber %s received a message on %s", s.name, msg.Subject)
+	s.debounce(s.cb)
+}
@@ -0,0 +1,169 @@
+package nats_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/nats"
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/nats/natstest"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/nats"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func newSubscriber(t *testing.T, config nats.Config) (subscriber.Subscriber, chan struct{}) {
+	called := make(chan struct{}, 1)
+	config.Debounce = "10ms"
+
+	s, err := nats.NewSubscriber(&subscriber.Options{
+		Name:   "test",
+		Config: config,
+		Logger: logging.NewNoOpLogger(),
+		Callback: func() {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create nats subscriber: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect nats subscriber: %s", err)
+	}
+
+	if err := s.Subscribe(context.Background()); err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+
+	return s, called
+}
+
+func connect(t *testing.T, config *client.Config) *client.Client {
+	c, err := client.NewClient(config)
+	if err != nil {
+		t.Fatalf("failed to connect to nats: %s", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func expectCall(t *testing.T, called chan struct{}, expected bool) {
+	t.Helper()
+
+	timeout := 200 * time.Millisecond
+	if expected {
+		timeout = 5 * time.Second
+	}
+
+	select {
+	case <-called:
+		if !expected {
+			t.Fatal("expected the callback not to be called")
+		}
+	case <-time.After(timeout):
+		if expected {
+			t.Fatal("expected the callback to be called after a message")
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	config := natstest.Start(t, "secret")
+	c := connect(t, config)
+
+	s, called := newSubscriber(t, nats.Config{
+		Topic: "bundles.*",
+		NATS:  config,
+	})
+	defer s.Disconnect(context.Background())
+
+	c.NATS().Publish("other", []byte(`{"etag":"abc"}`))
+	c.NATS().Flush()
+	expectCall(t, called, false)
+
+	c.NATS().Publish("bundles.authz", []byte(`{"etag":"abc"}`))
+	c.NATS().Flush()
+	expectCall(t, called, true)
+}
+
+func TestAuth(t *testing.T) {
+	config := natstest.Start(t, "secret")
+	config.Token = "wrong"
+
+	s, err := nats.NewSubscriber(&subscriber.Options{
+		Name: "test",
+		Config: nats.Config{
+			Topic: "bundles",
+			NATS:  config,
+		},
+		Logger: logging.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create nats subscriber: %s", err)
+	}
+
+	if err := s.Connect(context.Background()); err == nil {
+		s.Disconnect(context.Background())
+		t.Fatal("expected an authorization error")
+	}
+}
+
+func TestJetStream(t *testing.T) {
+	config := natstest.Start(t, "")
+	c := connect(t, config)
+
+	js, err := c.JetStream()
+	if err != nil {
+		t.Fatalf("failed to get jetstream context: %s", err)
+	}
+
+	if _, err := js.AddStream(&natsgo.StreamConfig{
+		Name:     "BUNDLES",
+		Subjects: []string{"bundles.>"},
+	}); err != nil {
+		t.Fatalf("failed to create stream: %s", err)
+	}
+
+	subConfig := nats.Config{
+		Topic: "bundles.authz",
+		JetStream: &nats.JetStreamConfig{
+			Stream:  "BUNDLES",
+			Durable: "server1",
+		},
+		NATS: config,
+	}
+
+	s, called := newSubscriber(t, subConfig)
+
+	if _, err := js.Publish("bundles.other", []byte(`{"etag":"abc"}`)); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+	expectCall(t, called, false)
+
+	if _, err := js.Publish("bundles.authz", []byte(`{"etag":"abc"}`)); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+	expectCall(t, called, true)
+
+	// messages published while the subscriber is stopped
+	// are delivered by the durable consumer
+	if err := s.Disconnect(context.Background()); err != nil {
+		t.Fatalf("failed to disconnect: %s", err)
+	}
+
+	// allow the server to remove the interest of the closed connection
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := js.Publish("bundles.authz", []byte(`{"etag":"def"}`)); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+
+	s, called = newSubscriber(t, subConfig)
+	defer s.Disconnect(context.Background())
+	expectCall(t, called, true)
+}
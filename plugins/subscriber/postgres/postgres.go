@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/bep/debounce"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/lib/pq"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	ProviderName                = "postgres"
+	DefaultDebounce             = "200ms"
+	DefaultMinReconnectInterval = "1s"
+	DefaultMaxReconnectInterval = "1m"
+	pingInterval                = 90 * time.Second
+)
+
+func init() {
+	subscriber.Providers[ProviderName] = NewSubscriber
+}
+
+type Subscriber struct {
+	mx           sync.Mutex
+	name         string
+	cb           func()
+	listener     *pq.Listener
+	config       *Config
+	logger       logger.Logger
+	debounce     func(f func())
+	minReconnect time.Duration
+	maxReconnect time.Duration
+	cancel       context.CancelFunc
+}
+
+type Config struct {
+	DSN                  string `json:"dsn" yaml:"dsn"`
+	DSNEnv               string `json:"dsn_env" yaml:"dsn_env"`
+	Channel              string `json:"channel" yaml:"channel"`
+	Debounce             string `json:"debounce" yaml:"debounce"`
+	MinReconnectInterval string `json:"min_reconnect_interval" yaml:"min_reconnect_interval"`
+	MaxReconnectInterval string `json:"max_reconnect_interval" yaml:"max_reconnect_interval"`
+
+	// Payload is a glob pattern notification payloads must match to
+	// trigger a rebuild. All notifications trigger a rebuild if it is empty
+	Payload string `json:"payload" yaml:"payload"`
+}
+
+// NewSubscriber creates a new subscriber
+func NewSubscriber(opts *subscriber.Options) (subscriber.Subscriber, error) {
+	s := &Subscriber{
+		name:   opts.Name,
+		config: &Config{},
+		cb:     opts.Callback,
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for subscriber %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.DSN == "" && s.config.DSNEnv == "" {
+		return nil, fmt.Errorf("no dsn provided for postgres subscriber %s", opts.Name)
+	}
+
+	if s.config.Channel == "" {
+		return nil, fmt.Errorf("no channel specified for postgres subscriber %s", s.name)
+	}
+
+	if _, err := path.Match(s.config.Payload, ""); err != nil {
+		return nil, fmt.Errorf("invalid payload pattern for postgres subscriber %s: %s", s.name, err)
+	}
+
+	if s.config.Debounce == "" {
+		s.config.Debounce = DefaultDebounce
+	}
+
+	duration, err := time.ParseDuration(s.config.Debounce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debounce duration for postgres subscriber %s: %s", s.name, err)
+	}
+
+	s.debounce = debounce.New(duration)
+
+	if s.config.MinReconnectInterval == "" {
+		s.config.MinReconnectInterval = DefaultMinReconnectInterval
+	}
+
+	if s.minReconnect, err = time.ParseDuration(s.config.MinReconnectInterval); err != nil {
+		return nil, fmt.Errorf("invalid min reconnect interval for postgres subscriber %s: %s", s.name, err)
+	} else if s.minReconnect <= 0 {
+		return nil, fmt.Errorf("min reconnect interval for postgres subscriber %s must be positive", s.name)
+	}
+
+	if s.config.MaxReconnectInterval == "" {
+		s.config.MaxReconnectInterval = DefaultMaxReconnectInterval
+	}
+
+	if s.maxReconnect, err = time.ParseDuration(s.config.MaxReconnectInterval); err != nil {
+		return nil, fmt.Errorf("invalid max reconnect interval for postgres subscriber %s: %s", s.name, err)
+	} else if s.maxReconnect < s.minReconnect {
+		return nil, fmt.Errorf("max reconnect interval for postgres subscriber %s must not be less than the min reconnect interval", s.name)
+	}
+
+	return s, nil
+}
+
+// Connect creates the listener. The listener reconnects with
+// a backoff between the min and max reconnect intervals
+func (s *Subscriber) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to postgres subscriber %s", s.name)
+	if s.listener != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	dsn := s.config.DSN
+	if s.config.DSNEnv != "" {
+		if dsn = os.Getenv(s.config.DSNEnv); dsn == "" {
+			return fmt.Errorf("dsn environment variable %s is not set", s.config.DSNEnv)
+		}
+	}
+
+	// verify the database is reachable before listening
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	if err = db.PingContext(ctx); err != nil {
+		return
+	}
+
+	s.listener = pq.NewListener(dsn, s.minReconnect, s.maxReconnect, s.event)
+	return
+}
+
+func (s *Subscriber) Disconnect(ctx context.Context) (err error) {
+	if s.listener == nil {
+		err = fmt.Errorf("not connected")
+		return
+	}
+
+	s.Unsubscribe(ctx)
+	err = s.listener.Close()
+	s.listener = nil
+	return
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.cancel != nil {
+		err = fmt.Errorf("postgres listener already started on subscriber %s", s.name)
+		return
+	}
+
+	var listenCtx context.Context
+	listenCtx, s.cancel = context.WithCancel(context.Background())
+	go s.listen(listenCtx)
+
+	return
+}
+
+func (s *Subscriber) Unsubscribe(ctx context.Context) (err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.cancel == nil {
+		err = fmt.Errorf("postgres listener on subscriber %s is already stopped", s.name)
+		return
+	}
+
+	s.cancel()
+	s.cancel = nil
+	return s.listener.Unlisten(s.config.Channel)
+}
+
+// Matches returns true if a notification payload triggers a rebuild
+func (s *Subscriber) Matches(payload string) bool {
+	if s.config.Payload == "" {
+		return true
+	}
+
+	matched, _ := path.Match(s.config.Payload, payload)
+	return matched
+}
+
+// listen handles notifications until the context is canceled. Listening
+// on the channel is retried with a backoff if it fails
+func (s *Subscriber) listen(ctx context.Context) {
+	defer s.stopped(ctx)
+
+	notify := s.listener.NotificationChannel()
+
+	// listen blocks until the listener is connected
+	for retry := 0; ; retry++ {
+		err := s.listener.Listen(s.config.Channel)
+		if err == nil || err == pq.ErrChannelAlreadyOpen {
+			break
+		}
+
+		delay := util.DefaultBackoff(float64(s.minReconnect), float64(s.maxReconnect), retry)
+		s.logger.Error("postgres subscriber %s failed to listen on channel %s, retrying in %s: %s", s.name, s.config.Channel, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	s.logger.Debug("postgres subscriber %s is listening on channel %s", s.name, s.config.Channel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case n, ok := <-notify:
+			if !ok {
+				s.logger.Error("postgres subscriber %s listener was closed", s.name)
+				return
+			}
+
+			// a nil notification is sent after reconnecting, rebuild
+			// since notifications may have been missed
+			if n == nil {
+				s.logger.Debug("postgres subscriber %s reconnected", s.name)
+			} else if !s.Matches(n.Extra) {
+				s.logger.Debug("postgres subscriber %s ignored a message with payload %q", s.name, n.Extra)
+				continue
+			} else {
+				s.logger.Debug("postgres subscriber %s received a message", s.name)
+			}
+			s.debounce(s.cb)
+
+		case <-time.After(pingInterval):
+			// detect connections that were lost without an error
+			go s.listener.Ping()
+		}
+	}
+}
+
+// stopped clears the listener state if listening stopped without
+// being unsubscribed so that the subscriber can be subscribed again
+func (s *Subscriber) stopped(ctx context.Context) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if ctx.Err() == nil && s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// event logs listener connection events
+func (s *Subscriber) event(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventConnected:
+		s.logger.Debug("postgres subscriber %s connected", s.name)
+	case pq.ListenerEventDisconnected:
+		s.logger.Warn("postgres subscriber %s disconnected: %s", s.name, err)
+	case pq.ListenerEventReconnected:
+		s.logger.Info("postgres subscriber %s reconnected", s.name)
+	case pq.ListenerEventConnectionAttemptFailed:
+		s.logger.Error("postgres subscriber %s failed to connect: %s", s.name, err)
+	}
+}
@@ -0,0 +1,78 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/postgres"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func newSubscriber(config interface{}) (subscriber.Subscriber, error) {
+	return postgres.NewSubscriber(&subscriber.Options{
+		Name:     "test",
+		Config:   config,
+		Logger:   logging.NewNoOpLogger(),
+		Callback: func() {},
+	})
+}
+
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config interface{}
+		valid  bool
+	}{
+		{"valid", postgres.Config{DSN: "postgres://localhost/db", Channel: "bundles"}, true},
+		{"dsn env", postgres.Config{DSNEnv: "DATABASE_URL", Channel: "bundles"}, true},
+		{"no config", nil, false},
+		{"no dsn", postgres.Config{Channel: "bundles"}, false},
+		{"no channel", postgres.Config{DSN: "postgres://localhost/db"}, false},
+		{"invalid debounce", postgres.Config{DSN: "postgres://localhost/db", Channel: "bundles", Debounce: "soon"}, false},
+		{"invalid payload", postgres.Config{DSN: "postgres://localhost/db", Channel: "bundles", Payload: "authz/["}, false},
+		{"invalid min reconnect", postgres.Config{DSN: "postgres://localhost/db", Channel: "bundles", MinReconnectInterval: "0s"}, false},
+		{"invalid max reconnect", postgres.Config{DSN: "postgres://localhost/db", Channel: "bundles", MinReconnectInterval: "10s", MaxReconnectInterval: "1s"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSubscriber(tt.config)
+			if tt.valid && err != nil {
+				t.Errorf("expected a valid config, got %s", err)
+			} else if !tt.valid && err == nil {
+				t.Errorf("expected an invalid config")
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		payload string
+		matches bool
+	}{
+		{"", "", true},
+		{"", "anything", true},
+		{"authz", "authz", true},
+		{"authz", "authz2", false},
+		{"authz/*", "authz/policy.rego", true},
+		{"authz/*", "other/policy.rego", false},
+		{"authz/*", "authz/users/data.json", false},
+	}
+
+	for _, tt := range tests {
+		s, err := newSubscriber(postgres.Config{
+			DSN:     "postgres://localhost/db",
+			Channel: "bundles",
+			Payload: tt.pattern,
+		})
+		if err != nil {
+			t.Fatalf("failed to create postgres subscriber: %s", err)
+		}
+
+		if matches := s.(*postgres.Subscriber).Matches(tt.payload); matches != tt.matches {
+			t.Errorf("expected pattern %q matching payload %q to be %t", tt.pattern, tt.payload, tt.matches)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bep/debounce"
+	"github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/core/logger"
+	"github.com/bhoriuchi/opa-bundle-server/core/utils"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const (
+	ProviderName       = "redis"
+	DefaultDebounce    = "200ms"
+	WatchTypeChannel   = "channel"
+	WatchTypePattern   = "pattern"
+	WatchTypeKeyspace  = "keyspace"
+	messageChannelSize = 100
+)
+
+func init() {
+	subscriber.Providers[ProviderName] = NewSubscriber
+}
+
+type Subscriber struct {
+	name     string
+	cb       func()
+	client   *redis.Client
+	pubsub   *goredis.PubSub
+	config   *Config
+	logger   logger.Logger
+	debounce func(f func())
+}
+
+// Config configures the subscription. The channel watch type subscribes
+// to the topic, pattern subscribes to a glob pattern, and keyspace
+// subscribes to keyspace notifications for the keys under the topic
+type Config struct {
+	WatchType string        `json:"watch_type" yaml:"watch_type"`
+	Topic     string        `json:"topic" yaml:"topic"`
+	Debounce  string        `json:"debounce" yaml:"debounce"`
+	Redis     *redis.Config `json:"redis" yaml:"redis"`
+}
+
+// NewSubscriber creates a new subscriber
+func NewSubscriber(opts *subscriber.Options) (subscriber.Subscriber, error) {
+	s := &Subscriber{
+		name:   opts.Name,
+		config: &Config{},
+		cb:     opts.Callback,
+		logger: opts.Logger,
+	}
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("invalid configuration for subscriber %s", opts.Name)
+	}
+
+	if err := utils.ReMarshal(opts.Config, s.config); err != nil {
+		return nil, err
+	}
+
+	if s.config.Debounce == "" {
+		s.config.Debounce = DefaultDebounce
+	}
+
+	duration, err := time.ParseDuration(s.config.Debounce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debounce duration for redis subscriber %s: %s", s.name, err)
+	}
+
+	s.debounce = debounce.New(duration)
+
+	if s.config.Redis == nil {
+		return nil, fmt.Errorf("no redis configuration provided for subscriber %s", opts.Name)
+	}
+
+	if s.config.Topic == "" {
+		return nil, fmt.Errorf("no topic specified for redis subscriber %s", s.name)
+	}
+
+	switch s.config.WatchType {
+	case WatchTypeChannel, WatchTypePattern, WatchTypeKeyspace:
+	case "":
+		s.config.WatchType = WatchTypeChannel
+	default:
+		return nil, fmt.Errorf("unsupported watch type %q for redis subscriber %s", s.config.WatchType, s.name)
+	}
+
+	return s, nil
+}
+
+func (s *Subscriber) Connect(ctx context.Context) (err error) {
+	s.logger.Debug("connecting to redis subscriber %s", s.name)
+	if s.client != nil {
+		return fmt.Errorf("already connected")
+	}
+
+	s.client, err = redis.NewClient(s.config.Redis)
+	return
+}
+
+func (s *Subscriber) Disconnect(ctx context.Context) (err error) {
+	if s.client == nil {
+		err = fmt.Errorf("not connected")
+		return
+	}
+
+	s.Unsubscribe(ctx)
+	err = s.client.Close()
+	s.client = nil
+	return
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context) (err error) {
+	if s.pubsub != nil {
+		err = fmt.Errorf("redis subscription already started on subscriber %s", s.name)
+		return
+	}
+
+	switch s.config.WatchType {
+	case WatchTypeChannel:
+		s.pubsub = s.client.Redis().Subscribe(ctx, s.config.Topic)
+	case WatchTypePattern:
+		s.pubsub = s.client.Redis().PSubscribe(ctx, s.config.Topic)
+	case WatchTypeKeyspace:
+		s.pubsub = s.client.Redis().PSubscribe(ctx, s.keyspacePattern())
+	}
+
+	// wait for the subscription to be confirmed
+	if _, err = s.pubsub.Receive(ctx); err != nil {
+		s.pubsub.Close()
+		s.pubsub = nil
+		return
+	}
+
+	go s.receive(s.pubsub.ChannelWithSubscriptions(ctx, messageChannelSize))
+	return
+}
+
+func (s *Subscriber) Unsubscribe(ctx context.Context) (err error) {
+	if s.pubsub == nil {
+		err = fmt.Errorf("redis subscription on subscriber %s is already stopped", s.name)
+		return
+	}
+
+	err = s.pubsub.Close()
+	s.pubsub = nil
+	return
+}
+
+// receive handles messages until the subscription is closed
+func (s *Subscriber) receive(ch <-chan interface{}) {
+	s.logger.Debug("redis subscriber %s is subscribed to %s %s", s.name, s.config.WatchType, s.config.Topic)
+
+	for msg := range ch {
+		switch m := msg.(type) {
+		case *goredis.Subscription:
+			// subscriptions are renewed after reconnecting, rebuild
+			// since messages may have been missed
+			if m.Kind == "subscribe" || m.Kind == "psubscribe" {
+				s.logger.Debug("redis subscriber %s resubscribed", s.name)
+				s.debounce(s.cb)
+			}
+		case *goredis.Message:
+			s.logger.Debug("redis subscriber %s received a message", s.name)
+			s.debounce(s.cb)
+		}
+	}
+}
+
+// keyspacePattern is the pattern of keyspace notifications for the keys
+// under the topic. The server must have notify-keyspace-events enabled
+func (s *Subscriber) keyspacePattern() string {
+	return fmt.Sprintf("__keyspace@%d__:%s*", s.client.DB(), redis.EscapePattern(s.config.Topic))
+}
@@ -0,0 +1,86 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	client "github.com/bhoriuchi/opa-bundle-server/core/clients/redis"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber"
+	"github.com/bhoriuchi/opa-bundle-server/plugins/subscriber/redis"
+	"github.com/open-policy-agent/opa/logging"
+)
+
+func TestSubscribe(t *testing.T) {
+	tests := []struct {
+		name      string
+		watchType string
+		topic     string
+		ignored   string
+		channel   string
+	}{
+		{"channel", "", "bundles", "other", "bundles"},
+		{"pattern", "pattern", "bundles.*", "other", "bundles.authz"},
+		{"keyspace", "keyspace", "bundles/authz/", "__keyspace@0__:bundles/other/policy.rego", "__keyspace@0__:bundles/authz/policy.rego"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mr, err := miniredis.Run()
+			if err != nil {
+				t.Fatalf("failed to start miniredis: %s", err)
+			}
+			defer mr.Close()
+
+			called := make(chan struct{}, 1)
+			s, err := redis.NewSubscriber(&subscriber.Options{
+				Name: "test",
+				Config: redis.Config{
+					WatchType: tt.watchType,
+					Topic:     tt.topic,
+					Debounce:  "10ms",
+					Redis: &client.Config{
+						Address: mr.Addr(),
+					},
+				},
+				Logger: logging.NewNoOpLogger(),
+				Callback: func() {
+					select {
+					case called <- struct{}{}:
+					default:
+					}
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create redis subscriber: %s", err)
+			}
+
+			if err := s.Connect(ctx); err != nil {
+				t.Fatalf("failed to connect redis subscriber: %s", err)
+			}
+			defer s.Disconnect(ctx)
+
+			if err := s.Subscribe(ctx); err != nil {
+				t.Fatalf("failed to subscribe: %s", err)
+			}
+
+			mr.Publish(tt.ignored, "set")
+
+			select {
+			case <-called:
+				t.Fatal("expected messages on other channels to be ignored")
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			mr.Publish(tt.channel, "set")
+
+			select {
+			case <-called:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the callback to be called after a message")
+			}
+		})
+	}
+}